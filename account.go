@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// passwordFlags 读取 keystore 密码的方式，见 readPassphrase。
+var passwordFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "password-file",
+		Value: "",
+		Usage: "read the keystore passphrase from the first line of this file",
+	},
+	&cli.IntFlag{
+		Name:  "password-fd",
+		Value: -1,
+		Usage: "read the keystore passphrase from this file descriptor",
+	},
+}
+
+// keystoreFlags 定位 keystore 目录以及读取密码的方式。
+var keystoreFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:  "keystore",
+		Value: defaultKeystoreDir(),
+		Usage: "the directory of the encrypted keystore",
+	},
+}, passwordFlags...)
+
+var accountFlag = &cli.StringFlag{
+	Name:  "account",
+	Value: "",
+	Usage: "the address or index of the keystore account used to sign",
+}
+
+// keyFlags 选择出账私钥的参数，可以直接给出私钥，也可以从加密的 keystore 中解锁或从助记词派生。
+var keyFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:  "fromKey",
+		Value: "",
+		Usage: "deprecated, the key ends up in the shell history and the process list; use --account",
+	},
+	accountFlag,
+	&cli.StringFlag{
+		Name:  "signer",
+		Value: "",
+		Usage: "sign with an external signer (clef) at this IPC path or http(s):// URL, --account is then its address",
+	},
+}, append(hdKeyFlags, keystoreFlags...)...)
+
+var accountCmd = &cli.Command{
+	Name:  "account",
+	Usage: "manage the encrypted keystore accounts",
+	Subcommands: []*cli.Command{
+		accountNewCmd,
+		accountImportCmd,
+		accountListCmd,
+		accountExportCmd,
+		accountDeriveCmd,
+	},
+}
+
+var accountNewCmd = &cli.Command{
+	Name:  "new",
+	Usage: "create a new account in the keystore",
+	Flags: keystoreFlags,
+	Action: func(c *cli.Context) error {
+		ks := openKeystore(keystoreDir(c))
+		passphrase, err := readPassphrase(c, true)
+		if err != nil {
+			return err
+		}
+
+		account, err := ks.NewAccount(passphrase)
+		if err != nil {
+			return err
+		}
+
+		return printAccount(account)
+	},
+}
+
+var accountImportCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "import a keyfile, or a raw hex private key read from stdin or the prompt, into the keystore",
+	ArgsUsage: "[keyfile]",
+	Flags:     keystoreFlags,
+	Action: func(c *cli.Context) error {
+		if c.NArg() > 1 {
+			return xerrors.New("expected at most one keyfile")
+		}
+
+		ks := openKeystore(keystoreDir(c))
+
+		var account accounts.Account
+		if c.NArg() == 1 {
+			// 私钥不接受作为参数，避免留在 shell 历史和进程列表中
+			keyJSON, err := ioutil.ReadFile(c.Args().First())
+			if err != nil {
+				return xerrors.Errorf("read keyfile (raw private keys are read from stdin or the prompt): %w", err)
+			}
+			oldPassphrase, err := prompt.Stdin.PromptPassword("Passphrase of the keyfile: ")
+			if err != nil {
+				return err
+			}
+			passphrase, err := readPassphrase(c, true)
+			if err != nil {
+				return err
+			}
+			account, err = ks.Import(keyJSON, oldPassphrase, passphrase)
+			if err != nil {
+				return err
+			}
+		} else {
+			hexKey, err := prompt.Stdin.PromptPassword("Private key: ")
+			if err != nil {
+				return err
+			}
+			privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+			if err != nil {
+				return xerrors.Errorf("invalid private key: %w", err)
+			}
+			passphrase, err := readPassphrase(c, true)
+			if err != nil {
+				return err
+			}
+			account, err = ks.ImportECDSA(privateKey, passphrase)
+			if err != nil {
+				return err
+			}
+		}
+
+		return printAccount(account)
+	},
+}
+
+var accountListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "list the accounts in the keystore",
+	Flags: keystoreFlags,
+	Action: func(c *cli.Context) error {
+		ks := openKeystore(keystoreDir(c))
+		var result []*AccountResult
+		for _, account := range ks.Accounts() {
+			result = append(result, &AccountResult{Address: account.Address, Keyfile: account.URL.Path})
+		}
+		return printResult(result, func() {
+			for i, account := range result {
+				fmt.Printf("#%d: %s %s\n", i, account.Address.Hex(), account.Keyfile)
+			}
+		})
+	},
+}
+
+var accountExportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "export an account as a keyfile encrypted with a new passphrase",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "out",
+			Value: "",
+			Usage: "write the keyfile to this path instead of stdout",
+		},
+		accountFlag,
+	}, keystoreFlags...),
+	Action: func(c *cli.Context) error {
+		ks := openKeystore(keystoreDir(c))
+		account, err := findAccount(ks, c.String("account"))
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := readPassphrase(c, false)
+		if err != nil {
+			return err
+		}
+		newPassphrase, err := promptNewPassphrase("New passphrase of the exported keyfile: ")
+		if err != nil {
+			return err
+		}
+
+		keyJSON, err := ks.Export(account, passphrase, newPassphrase)
+		if err != nil {
+			return err
+		}
+
+		if out := c.String("out"); out != "" {
+			return ioutil.WriteFile(out, keyJSON, 0600)
+		}
+		return printResult(json.RawMessage(keyJSON), func() {
+			fmt.Println(string(keyJSON))
+		})
+	},
+}
+
+// AccountResult keystore 中的一个账户。
+type AccountResult struct {
+	Address common.Address `json:"address"`
+	Keyfile string         `json:"keyfile"`
+}
+
+func printAccount(account accounts.Account) error {
+	return printResult(&AccountResult{Address: account.Address, Keyfile: account.URL.Path}, func() {
+		fmt.Printf("address: %s\nkeyfile: %s\n", account.Address.Hex(), account.URL.Path)
+	})
+}
+
+// loadKey 根据命令行参数取得出账的私钥，优先使用 --fromKey，否则解锁 keystore 中的账户。
+func loadKey(c *cli.Context) (*ecdsa.PrivateKey, error) {
+	if fromKey := c.String("fromKey"); fromKey != "" {
+		fmt.Fprintln(os.Stderr, "warning: --fromKey is deprecated, the private key ends up in the shell history and the process list; use --account, --mnemonic-file or --signer")
+		return crypto.HexToECDSA(strings.TrimPrefix(fromKey, "0x"))
+	}
+	if c.String("mnemonic-file") != "" {
+		return loadDerivedKey(c)
+	}
+
+	ks := openKeystore(keystoreDir(c))
+	account, err := findAccount(ks, c.String("account"))
+	if err != nil {
+		return nil, err
+	}
+
+	keyJSON, err := ioutil.ReadFile(account.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := readPassphrase(c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, xerrors.Errorf("unlock %s: %w", account.Address.Hex(), err)
+	}
+
+	return key.PrivateKey, nil
+}
+
+// loadSigner 返回签名用的 payments.Signer：指定了 --signer 时使用外部签名服务，否则使用 loadKey 的私钥。
+func loadSigner(c *cli.Context) (payments.Signer, error) {
+	endpoint := c.String("signer")
+	if endpoint == "" {
+		privateKey, err := loadKey(c)
+		if err != nil {
+			return nil, err
+		}
+		return payments.NewKeySigner(privateKey), nil
+	}
+
+	var address common.Address
+	if account := c.String("account"); account != "" {
+		if !common.IsHexAddress(account) {
+			return nil, xerrors.Errorf("--account must be an address with --signer: %s", account)
+		}
+		address = common.HexToAddress(account)
+	}
+	return payments.NewClefSigner(context.Background(), endpoint, address)
+}
+
+func defaultKeystoreDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "keystore"
+	}
+	return filepath.Join(dir, "geth-cli", "keystore")
+}
+
+func openKeystore(dir string) *keystore.KeyStore {
+	return keystore.NewKeyStore(dir, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// findAccount 按地址或序号查找账户，keystore 中只有一个账户时可以省略。
+func findAccount(ks *keystore.KeyStore, account string) (accounts.Account, error) {
+	all := ks.Accounts()
+	if account == "" {
+		if len(all) == 1 {
+			return all[0], nil
+		}
+		return accounts.Account{}, xerrors.Errorf("keystore has %d accounts, specify one with --account or --fromKey", len(all))
+	}
+
+	if common.IsHexAddress(account) {
+		return ks.Find(accounts.Account{Address: common.HexToAddress(account)})
+	}
+
+	index, err := strconv.Atoi(account)
+	if err != nil || index < 0 || index >= len(all) {
+		return accounts.Account{}, xerrors.Errorf("unknown account: %s", account)
+	}
+	return all[index], nil
+}
+
+// readPassphrase 从 --password-file、--password-fd 或终端读取 keystore 的密码。
+func readPassphrase(c *cli.Context, confirm bool) (string, error) {
+	if file := c.String("password-file"); file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return readFirstLine(f)
+	}
+
+	if fd := c.Int("password-fd"); fd >= 0 {
+		return readFirstLine(os.NewFile(uintptr(fd), "password-fd"))
+	}
+
+	if confirm {
+		return promptNewPassphrase("Passphrase: ")
+	}
+	return prompt.Stdin.PromptPassword("Passphrase: ")
+}
+
+func promptNewPassphrase(p string) (string, error) {
+	passphrase, err := prompt.Stdin.PromptPassword(p)
+	if err != nil {
+		return "", err
+	}
+	confirm, err := prompt.Stdin.PromptPassword("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", xerrors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func readFirstLine(f *os.File) (string, error) {
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", xerrors.Errorf("read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
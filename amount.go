@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// ethUnits 以太坊金额单位对应的小数位数。
+var ethUnits = map[string]uint8{
+	"wei":    0,
+	"kwei":   3,
+	"mwei":   6,
+	"gwei":   9,
+	"szabo":  12,
+	"finney": 15,
+	"eth":    18,
+	"ether":  18,
+}
+
+// parseAmount 解析带单位的金额（如 "1.5eth"、"2gwei"、"12.34bzz"、"100 USDC2"），返回最小单位的整数。
+// 有空格时按第一个空格分开金额和单位，否则单位从第一个字母开始，可以含数字；以数字开头的单位（如 1INCH）需要用空格分开。
+// units 为允许的单位及其小数位数，defaultUnit 为空时金额必须带单位。
+func parseAmount(s string, units map[string]uint8, defaultUnit string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	number, unit := s, ""
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		number, unit = s[:i], strings.TrimSpace(s[i:])
+	} else if i := strings.IndexFunc(s, unicode.IsLetter); i >= 0 {
+		number, unit = s[:i], s[i:]
+	}
+
+	unit = strings.ToLower(unit)
+	if unit == "" {
+		if defaultUnit == "" {
+			return nil, xerrors.Errorf("amount %s needs a unit, e.g. %s", s, unitExamples(units))
+		}
+		unit = defaultUnit
+	}
+
+	decimals, ok := units[unit]
+	if !ok {
+		return nil, xerrors.Errorf("unknown unit %s in amount %s, expected one of %s", unit, s, unitExamples(units))
+	}
+	return parseDecimal(number, decimals)
+}
+
+func unitExamples(units map[string]uint8) string {
+	var names []string
+	for name := range units {
+		if name != "" && unicode.IsDigit(rune(name[0])) {
+			name = " " + name
+		}
+		names = append(names, "1"+name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// parseDecimal 把十进制字符串（如 "12.34"）精确转换为最小单位的整数，小数位数不能超过 decimals。
+func parseDecimal(s string, decimals uint8) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, xerrors.New("empty amount")
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > int(decimals) {
+		return nil, xerrors.Errorf("amount %s has more than %d decimals", s, decimals)
+	}
+	fracPart += strings.Repeat("0", int(decimals)-len(fracPart))
+
+	v, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok || v.Sign() < 0 || strings.ContainsAny(intPart+fracPart, "+-") {
+		return nil, xerrors.Errorf("invalid amount: %s", s)
+	}
+	return v, nil
+}
+
+// formatDecimal 把最小单位的整数格式化为带小数点的十进制字符串。
+func formatDecimal(v *big.Int, decimals uint8) string {
+	if v == nil {
+		return "0"
+	}
+
+	neg := v.Sign() < 0
+	digits := new(big.Int).Abs(v).String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+
+	intPart, fracPart := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	out := intPart
+	if fracPart != "" {
+		out += "." + fracPart
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"geth-cli/jsonrpc"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// balanceBatchSize 每个批量请求包含的调用数。
+const balanceBatchSize = 200
+
+var balanceCmd = &cli.Command{
+	Name:      "balance",
+	Usage:     "show eth and token balances of many addresses",
+	ArgsUsage: "[address...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "file",
+			Value: "",
+			Usage: "read addresses from this file (one per line or the first CSV column), - for stdin",
+		},
+		&cli.StringSliceFlag{
+			Name:  "token",
+			Usage: "also show these ERC-20 tokens (contract address or alias), may be repeated",
+		},
+		&cli.BoolFlag{
+			Name:  "eth",
+			Value: true,
+			Usage: "show the eth balance, --eth=false for tokens only",
+		},
+		&cli.StringFlag{
+			Name:  "block",
+			Value: "latest",
+			Usage: "the block number (or latest, pending, earliest) to read the balances at",
+		},
+		&cli.BoolFlag{
+			Name:  "csv",
+			Usage: "print CSV instead of a table (use the global --output json|yaml for json or yaml)",
+		},
+		mnemonicFileFlag,
+		hdRangeFlag,
+		&cli.BoolFlag{
+			Name:  "funded",
+			Usage: "only show addresses with a non-zero balance",
+		},
+	},
+	Before: connectNode,
+	Action: func(c *cli.Context) error {
+		args := c.Args().Slice()
+		paths := make(map[common.Address]string)
+		if c.String("mnemonic-file") != "" {
+			derived, err := deriveAccounts(c.String("mnemonic-file"), c.String("path"))
+			if err != nil {
+				return err
+			}
+			for _, account := range derived {
+				args = append(args, account.Address.Hex())
+				paths[account.Address] = account.Path
+			}
+		}
+
+		addresses, err := readAddresses(args, c.String("file"))
+		if err != nil {
+			return err
+		}
+
+		block, err := parseBlockTag(c.String("block"))
+		if err != nil {
+			return err
+		}
+
+		var assets []*TokenInfo
+		if c.Bool("eth") {
+			assets = append(assets, nil)
+		}
+		for _, t := range c.StringSlice("token") {
+			_, info, err := dialToken(t)
+			if err != nil {
+				return err
+			}
+			assets = append(assets, info)
+		}
+		if len(assets) == 0 {
+			return xerrors.New("nothing to show, use --token or --eth")
+		}
+
+		rows, err := LoadBalances(context.Background(), client, addresses, assets, block)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			row.Path = paths[row.Address]
+		}
+		if c.Bool("funded") {
+			rows = fundedBalances(rows)
+		}
+
+		if outputFormat != "text" {
+			return printResult(rows, nil)
+		}
+
+		if c.Bool("csv") {
+			return printBalancesCSV(os.Stdout, assets, rows)
+		}
+		return printBalancesTable(os.Stdout, assets, rows)
+	},
+}
+
+// AddressBalances 一个地址的所有余额，顺序和查询的资产一致，从助记词派生的地址带有派生路径。
+type AddressBalances struct {
+	Address  common.Address `json:"address"`
+	Path     string         `json:"path,omitempty"`
+	Balances []*Balance     `json:"balances"`
+}
+
+// Balance 一种资产的余额，Token 为空表示 ETH，查询失败时 Error 不为空。
+type Balance struct {
+	Symbol  string          `json:"symbol"`
+	Token   *common.Address `json:"token,omitempty"`
+	Balance string          `json:"balance,omitempty"`
+	Raw     string          `json:"raw,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// LoadBalances 用批量 JSON-RPC 请求查询每个地址在 block 时的余额，assets 中的 nil 表示 ETH。
+// 单个余额的查询失败记录在对应的 Balance.Error 中，只有整个批量请求失败时返回错误。
+func LoadBalances(ctx context.Context, rpc *jsonrpc.Client, addresses []common.Address, assets []*TokenInfo, block string) ([]*AddressBalances, error) {
+	rows := make([]*AddressBalances, len(addresses))
+	var batch []jsonrpc.BatchElem
+	var targets []*Balance
+
+	for i, address := range addresses {
+		rows[i] = &AddressBalances{Address: address}
+		for _, info := range assets {
+			b := &Balance{Symbol: "ETH"}
+			elem := jsonrpc.BatchElem{Method: "eth_getBalance", Params: []interface{}{address, block}, Result: new(hexutil.Big)}
+			if info != nil {
+				data, err := tokenABI.Pack("balanceOf", address)
+				if err != nil {
+					return nil, err
+				}
+				token := info.Address
+				b.Symbol, b.Token = info.Symbol, &token
+				elem = jsonrpc.BatchElem{
+					Method: "eth_call",
+					Params: []interface{}{map[string]interface{}{"to": token, "data": hexutil.Bytes(data)}, block},
+					Result: new(hexutil.Bytes),
+				}
+			}
+			rows[i].Balances = append(rows[i].Balances, b)
+			batch = append(batch, elem)
+			targets = append(targets, b)
+		}
+	}
+
+	for start := 0; start < len(batch); start += balanceBatchSize {
+		end := start + balanceBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		if err := rpc.BatchCall(ctx, batch[start:end]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, elem := range batch {
+		b, info := targets[i], assets[i%len(assets)]
+		if elem.Error != nil {
+			b.Error = elem.Error.Error()
+			continue
+		}
+
+		var raw *big.Int
+		decimals := uint8(18)
+		switch result := elem.Result.(type) {
+		case *hexutil.Big:
+			raw = result.ToInt()
+		case *hexutil.Bytes:
+			if len(*result) == 0 {
+				b.Error = "empty result, not a token contract at this block"
+				continue
+			}
+			raw = new(big.Int).SetBytes(*result)
+			decimals = info.Decimals
+		}
+		b.Raw = raw.String()
+		b.Balance = formatDecimal(raw, decimals)
+	}
+	return rows, nil
+}
+
+// fundedBalances 只保留至少有一种资产余额不为 0 的地址。
+func fundedBalances(rows []*AddressBalances) []*AddressBalances {
+	funded := []*AddressBalances{}
+	for _, row := range rows {
+		for _, b := range row.Balances {
+			if b.Raw != "" && b.Raw != "0" {
+				funded = append(funded, row)
+				break
+			}
+		}
+	}
+	return funded
+}
+
+func printBalancesTable(w io.Writer, assets []*TokenInfo, rows []*AddressBalances) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	withPath := hasPaths(rows)
+	if withPath {
+		fmt.Fprint(tw, "PATH\t")
+	}
+	fmt.Fprint(tw, "ADDRESS\t")
+	for _, info := range assets {
+		fmt.Fprintf(tw, "%s\t", assetSymbol(info))
+	}
+	fmt.Fprintln(tw)
+
+	for _, row := range rows {
+		if withPath {
+			fmt.Fprintf(tw, "%s\t", row.Path)
+		}
+		fmt.Fprintf(tw, "%s\t", row.Address.Hex())
+		for _, b := range row.Balances {
+			if b.Error != "" {
+				fmt.Fprint(tw, "error\t")
+			} else {
+				fmt.Fprintf(tw, "%s\t", b.Balance)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		for _, b := range row.Balances {
+			if b.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", row.Address.Hex(), b.Symbol, b.Error)
+			}
+		}
+	}
+	return nil
+}
+
+func printBalancesCSV(w io.Writer, assets []*TokenInfo, rows []*AddressBalances) error {
+	cw := csv.NewWriter(w)
+	withPath := hasPaths(rows)
+	header := []string{"address"}
+	if withPath {
+		header = append(header, "path")
+	}
+	for _, info := range assets {
+		header = append(header, assetSymbol(info))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := []string{row.Address.Hex()}
+		if withPath {
+			record = append(record, row.Path)
+		}
+		for _, b := range row.Balances {
+			if b.Error != "" {
+				record = append(record, "error: "+b.Error)
+			} else {
+				record = append(record, b.Balance)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func hasPaths(rows []*AddressBalances) bool {
+	for _, row := range rows {
+		if row.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func assetSymbol(info *TokenInfo) string {
+	if info == nil {
+		return "ETH"
+	}
+	return info.Symbol
+}
+
+// readAddresses 合并命令行参数和文件中的地址，去掉重复的地址，保留首次出现的顺序。
+func readAddresses(args []string, path string) ([]common.Address, error) {
+	lines := append([]string(nil), args...)
+	if path != "" {
+		var r io.Reader = os.Stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if i := strings.IndexAny(line, ",\t "); i >= 0 {
+				line = line[:i]
+			}
+			if line == "" || strings.HasPrefix(line, "#") || strings.EqualFold(line, "address") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var addresses []common.Address
+	var invalid []string
+	seen := make(map[common.Address]bool)
+	for _, line := range lines {
+		if !common.IsHexAddress(line) {
+			invalid = append(invalid, line)
+			continue
+		}
+		address := common.HexToAddress(line)
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, xerrors.Errorf("invalid addresses: %s", strings.Join(invalid, ", "))
+	}
+	if len(addresses) == 0 {
+		return nil, xerrors.New("no addresses, pass them as arguments or with --file")
+	}
+	return addresses, nil
+}
+
+// parseBlockTag 把十进制或 0x 开头的区块号转换为 JSON-RPC 的区块参数，latest、pending、earliest 原样返回。
+func parseBlockTag(block string) (string, error) {
+	switch block {
+	case "", "latest":
+		return "latest", nil
+	case "pending", "earliest":
+		return block, nil
+	}
+	if strings.HasPrefix(block, "0x") {
+		n, err := hexutil.DecodeUint64(block)
+		if err != nil {
+			return "", xerrors.Errorf("--block: %w", err)
+		}
+		return hexutil.EncodeUint64(n), nil
+	}
+	n, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return "", xerrors.Errorf("--block: %w", err)
+	}
+	return hexutil.EncodeUint64(n), nil
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"geth-cli/erc20-token"
+	"geth-cli/payments"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// 批量转账结果文件中每一行的状态。
+const (
+	batchSigned   = "signed"
+	batchSent     = "sent"
+	batchFailed   = "failed"
+	batchMined    = "mined"
+	batchReverted = "reverted"
+	batchReplaced = "replaced"
+)
+
+var batchFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "file",
+		Value:    "",
+		Required: true,
+		Usage:    "the payouts file, CSV (address,amount) or JSON ([{\"address\":...,\"amount\":...}])",
+	},
+	&cli.StringFlag{
+		Name:  "results",
+		Value: "",
+		Usage: "the results file used to resume the batch (default: <file>.results.csv)",
+	},
+	&cli.StringFlag{
+		Name:  "unit",
+		Value: "",
+		Usage: "the unit of amounts without one (default: eth or the token symbol)",
+	},
+	&cli.DurationFlag{
+		Name:  "interval",
+		Value: 500 * time.Millisecond,
+		Usage: "the pause between two transactions",
+	},
+}
+
+var batchEthCmd = &cli.Command{
+	Name:  "batch",
+	Usage: "pay many receivers from a CSV/JSON file, resumable after a crash",
+	Flags: append(append([]cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "gasLimit",
+			Value: 21000, // in units
+			Usage: "the amount of gas limit (wei)",
+		},
+	}, batchFlags...), append(append(feeFlags, waitFlags...), keyFlags...)...),
+	Action: func(c *cli.Context) error {
+		return runBatch(c, nil)
+	},
+}
+
+var tokenBatchCmd = &cli.Command{
+	Name:  "batch",
+	Usage: "pay many receivers from a CSV/JSON file, resumable after a crash",
+	Flags: append(append([]cli.Flag{
+		tokenFlag,
+		tokenGasLimitFlag,
+	}, batchFlags...), append(append(feeFlags, waitFlags...), keyFlags...)...),
+	Action: func(c *cli.Context) error {
+		_, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+		return runBatch(c, info)
+	},
+}
+
+// Payout 批量转账中的一行，Row 从 1 开始，不含表头。
+type Payout struct {
+	Row     int
+	Address common.Address
+	Amount  *big.Int
+	Text    string
+}
+
+// batchRecord 结果文件中的一条记录，同一行可能有多条记录，以最后一条为准。
+type batchRecord struct {
+	Row     int
+	Address string
+	Amount  string
+	Nonce   uint64
+	Hash    string
+	Status  string
+	GasUsed uint64
+	Raw     string
+	Error   string
+}
+
+// runBatch 执行批量转账，info 为空时转账 ETH。
+// 每笔交易在发送前先写入结果文件，中断后重新运行时只会重新广播已签名的交易，被节点拒绝的行以原来的 nonce 重新签名，不会重复付款。
+func runBatch(c *cli.Context, info *TokenInfo) error {
+	units, unit := ethUnits, "eth"
+	if info != nil {
+		units, unit = tokenUnits(info), strings.ToLower(info.Symbol)
+	}
+	if c.String("unit") != "" {
+		unit = strings.ToLower(c.String("unit"))
+	}
+
+	payouts, err := readPayouts(c.String("file"), units, unit)
+	if err != nil {
+		return err
+	}
+
+	resultsPath := c.String("results")
+	if resultsPath == "" {
+		resultsPath = c.String("file") + ".results.csv"
+	}
+	journal, err := openBatchJournal(resultsPath, dryRun)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	signer, err := loadSigner(c)
+	if err != nil {
+		return err
+	}
+
+	client, err := ethclient.Dial(defaultEndPoint)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	from := signer.Address()
+
+	chainID, err := signingChainID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	feeOpts, err := feeOptionsFromContext(c)
+	if err != nil {
+		return err
+	}
+	fees, err := payments.SuggestFees(ctx, client, feeOpts)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	b := &batchSender{
+		client:   client,
+		signer:   signer,
+		from:     from,
+		chainID:  chainID,
+		info:     info,
+		fees:     fees,
+		gasLimit: c.Uint64("gasLimit"),
+		margin:   feeOpts.GasMargin,
+		nonces:   newNonceManager(chainID, from),
+		journal:  journal,
+	}
+
+	// 先处理上次中断时已经签名的交易
+	for _, p := range payouts {
+		record := journal.records[p.Row]
+		if record == nil {
+			continue
+		}
+		if !strings.EqualFold(record.Address, p.Address.Hex()) || record.Amount != p.Text {
+			return xerrors.Errorf("row %d of %s does not match the results file %s, use a new --results file for a changed batch", p.Row, c.String("file"), resultsPath)
+		}
+		if record.Nonce >= nonce {
+			nonce = record.Nonce + 1
+		}
+		if dryRun {
+			continue
+		}
+		if err := b.resume(ctx, p, record); err != nil {
+			return err
+		}
+	}
+
+	var todo []*Payout
+	for _, p := range payouts {
+		if journal.records[p.Row] == nil {
+			todo = append(todo, p)
+		}
+	}
+
+	if err := checkBatchBalance(ctx, client, from, info, todo, fees, c.Uint64("gasLimit")); err != nil {
+		return err
+	}
+
+	log.Printf("batch: %d rows, %d already handled, sending %d from nonce %d (%s)", len(payouts), len(payouts)-len(todo), len(todo), nonce, fees)
+
+	for _, p := range todo {
+		// 和同一账户的其他发送者共用 nonce 日志，跳过它们已经占用的 nonce
+		var reservation *NonceReservation
+		if !dryRun {
+			if reservation, err = b.nonces.ReserveAtLeast(ctx, client, nonce); err != nil {
+				return err
+			}
+			nonce = reservation.Nonce
+		}
+
+		tx, err := b.sign(ctx, p, nonce)
+		if err != nil {
+			if reservation != nil {
+				reservation.Done(common.Hash{}, err)
+			}
+			return xerrors.Errorf("row %d: %w", p.Row, err)
+		}
+		if dryRun {
+			if err := simulateTx(ctx, client, tx); err != nil {
+				return xerrors.Errorf("row %d: %w", p.Row, err)
+			}
+			nonce++
+			continue
+		}
+
+		record := &batchRecord{Row: p.Row, Address: p.Address.Hex(), Amount: p.Text, Nonce: nonce}
+		if err := b.send(ctx, record, tx); err != nil {
+			return xerrors.Errorf("the remaining rows were not sent, run the batch again to resume: %w", err)
+		}
+		log.Printf("row %d: %s %s -> %s", p.Row, p.Text, p.Address.Hex(), record.Hash)
+
+		nonce++
+		time.Sleep(c.Duration("interval"))
+	}
+
+	if dryRun {
+		log.Printf("batch: dry run, %d transactions simulated, nothing sent or written to %s", len(todo), resultsPath)
+		return printResult(map[string]interface{}{"dryRun": true, "simulated": len(todo)}, nil)
+	}
+
+	if c.Bool("wait") {
+		if err := waitBatch(c, client, journal); err != nil {
+			return err
+		}
+	}
+
+	return journal.PrintSummary()
+}
+
+// newPayoutTx 以指定的 nonce 构造一笔 ETH 或代币转账。
+func newPayoutTx(ctx context.Context, client *ethclient.Client, from common.Address, info *TokenInfo, p *Payout, nonce, gasLimit, margin uint64, fees *payments.TxFees, chainID *big.Int) (*types.Transaction, error) {
+	if info == nil {
+		return fees.NewTx(chainID, nonce, p.Address, p.Amount, gasLimit, nil), nil
+	}
+
+	data, err := tokenABI.Pack("transfer", p.Address, p.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	gasLimit, err = estimateGas(ctx, client, ethereum.CallMsg{
+		From: from,
+		To:   &info.Address,
+		Data: data,
+	}, gasLimit, margin)
+	if err != nil {
+		return nil, err
+	}
+
+	return fees.NewTx(chainID, nonce, info.Address, big.NewInt(0), gasLimit, data), nil
+}
+
+// batchSender 一次批量转账共用的节点连接、签名账户、手续费和结果文件。
+type batchSender struct {
+	client   *ethclient.Client
+	signer   payments.Signer
+	from     common.Address
+	chainID  *big.Int
+	info     *TokenInfo
+	fees     *payments.TxFees
+	gasLimit uint64
+	margin   uint64
+	nonces   *NonceManager
+	journal  *batchJournal
+}
+
+// sign 以指定的 nonce 构造并签名一行付款。
+func (b *batchSender) sign(ctx context.Context, p *Payout, nonce uint64) (*types.Transaction, error) {
+	tx, err := newPayoutTx(ctx, b.client, b.from, b.info, p, nonce, b.gasLimit, b.margin, b.fees, b.chainID)
+	if err != nil {
+		return nil, err
+	}
+	return b.signer.SignTx(ctx, tx, b.chainID)
+}
+
+// send 先把签名后的交易写入结果文件和 nonce 日志再广播。
+// 广播失败时 nonce 日志中仍然保留这笔交易，nonce 留给这一行，重新运行时用新的手续费重新签名。
+func (b *batchSender) send(ctx context.Context, record *batchRecord, tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	record.Hash, record.Raw, record.Status, record.Error = tx.Hash().Hex(), hexutil.Encode(raw), batchSigned, ""
+	if err := b.journal.Append(record); err != nil {
+		if err := b.nonces.Release(record.Nonce); err != nil {
+			log.Printf("nonce journal: %s", err.Error())
+		}
+		return err
+	}
+	if err := b.nonces.Record(record.Nonce, tx.Hash()); err != nil {
+		log.Printf("nonce journal: %s", err.Error())
+	}
+
+	if err := payments.ClassifyError(sendTransaction(ctx, b.client, tx)); err != nil {
+		record.Status, record.Error = batchFailed, err.Error()
+		if err := b.journal.Append(record); err != nil {
+			return err
+		}
+		return xerrors.Errorf("row %d (nonce %d): %w", record.Row, record.Nonce, err)
+	}
+
+	record.Status = batchSent
+	return b.journal.Append(record)
+}
+
+// resume 检查上次运行留下的交易：已上链的记录结果，仍在交易池中的跳过。
+// nonce 未被使用时，被节点拒绝的交易（手续费低于 baseFee、价格不够或余额不足）用新的手续费重新签名，
+// 其他丢失的交易重新广播原交易。
+func (b *batchSender) resume(ctx context.Context, p *Payout, record *batchRecord) error {
+	switch record.Status {
+	case batchMined, batchReverted:
+		return nil
+	case batchReplaced:
+		log.Printf("row %d: nonce %d was used by another transaction, check it manually", record.Row, record.Nonce)
+		return nil
+	}
+
+	hash := common.HexToHash(record.Hash)
+	if receipt, err := b.client.TransactionReceipt(ctx, hash); err == nil {
+		record.Status, record.GasUsed = batchMined, receipt.GasUsed
+		if receipt.Status == types.ReceiptStatusFailed {
+			record.Status = batchReverted
+		}
+		return b.journal.Append(record)
+	}
+
+	if _, _, err := b.client.TransactionByHash(ctx, hash); err == nil {
+		return nil
+	}
+
+	latest, err := b.client.NonceAt(ctx, b.from, nil)
+	if err != nil {
+		return err
+	}
+	if latest > record.Nonce {
+		record.Status = batchReplaced
+		log.Printf("row %d: nonce %d was used by another transaction, check it manually", record.Row, record.Nonce)
+		return b.journal.Append(record)
+	}
+
+	if record.Status == batchFailed {
+		tx, err := b.sign(ctx, p, record.Nonce)
+		if err != nil {
+			return xerrors.Errorf("row %d: %w", record.Row, err)
+		}
+		log.Printf("row %d: re-signing nonce %d (%s)", record.Row, record.Nonce, b.fees)
+		return b.send(ctx, record, tx)
+	}
+
+	raw, err := hexutil.Decode(record.Raw)
+	if err != nil {
+		return xerrors.Errorf("row %d: %w", record.Row, err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return xerrors.Errorf("row %d: %w", record.Row, err)
+	}
+
+	log.Printf("row %d: rebroadcasting %s", record.Row, record.Hash)
+	if err := payments.ClassifyError(sendTransaction(ctx, b.client, tx)); err != nil {
+		record.Status, record.Error = batchFailed, err.Error()
+		if err := b.journal.Append(record); err != nil {
+			return err
+		}
+		return xerrors.Errorf("row %d (nonce %d): %w", record.Row, record.Nonce, err)
+	}
+
+	record.Status, record.Error = batchSent, ""
+	return b.journal.Append(record)
+}
+
+// checkBatchBalance 在发送之前确认余额足够支付所有待发送的行。
+func checkBatchBalance(ctx context.Context, client *ethclient.Client, from common.Address, info *TokenInfo, todo []*Payout, fees *payments.TxFees, gasLimit uint64) error {
+	total := new(big.Int)
+	for _, p := range todo {
+		total.Add(total, p.Amount)
+	}
+
+	if info != nil {
+		instance, err := token.NewTokenCaller(info.Address, client)
+		if err != nil {
+			return err
+		}
+		balance, err := instance.BalanceOf(&bind.CallOpts{Context: ctx}, from)
+		if err != nil {
+			return err
+		}
+		if balance.Cmp(total) < 0 {
+			return xerrors.Errorf("insufficient %s balance: have %s, batch needs %s", info.Symbol, formatDecimal(balance, info.Decimals), formatDecimal(total, info.Decimals))
+		}
+		return nil
+	}
+
+	price := fees.GasPrice
+	if price == nil {
+		price = fees.GasFeeCap
+	}
+	maxFee := new(big.Int).Mul(price, new(big.Int).SetUint64(gasLimit))
+	total.Add(total, maxFee.Mul(maxFee, big.NewInt(int64(len(todo)))))
+
+	balance, err := client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(total) < 0 {
+		return xerrors.Errorf("insufficient balance: have %s eth, batch needs up to %s eth", formatDecimal(balance, 18), formatDecimal(total, 18))
+	}
+	return nil
+}
+
+// waitBatch 等待所有已发送的交易上链，并把状态和 gas 用量写入结果文件。
+func waitBatch(c *cli.Context, client *ethclient.Client, journal *batchJournal) error {
+	ctx, cancel := waitContext(c)
+	defer cancel()
+
+	var failed int
+	for _, record := range journal.Records() {
+		if record.Status != batchSent {
+			continue
+		}
+
+		raw, err := hexutil.Decode(record.Raw)
+		if err != nil {
+			return err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return err
+		}
+
+		receipt, err := WaitForTx(ctx, client, tx, c.Uint64("confirmations"))
+		switch {
+		case err == nil:
+			record.Status, record.GasUsed = batchMined, receipt.GasUsed
+		case xerrors.Is(err, ErrTxReverted):
+			record.Status, record.GasUsed, record.Error = batchReverted, receipt.GasUsed, err.Error()
+			failed++
+		case xerrors.Is(err, ErrTxReplaced):
+			record.Status, record.Error = batchReplaced, err.Error()
+			failed++
+		default:
+			return err
+		}
+
+		if err := journal.Append(record); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		if err := journal.PrintSummary(); err != nil {
+			return err
+		}
+		return xerrors.Errorf("%d transactions of the batch did not succeed", failed)
+	}
+	return nil
+}
+
+// readPayouts 读取并校验整个付款文件，任何一行有误都不会发送。
+func readPayouts(path string, units map[string]uint8, unit string) ([]*Payout, error) {
+	type row struct {
+		Address string       `json:"address"`
+		Amount  payoutAmount `json:"amount"`
+	}
+
+	var rows []row
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, xerrors.Errorf("%s: %w", path, err)
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		r.Comment = '#'
+		for {
+			fields, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, xerrors.Errorf("%s: %w", path, err)
+			}
+			if len(rows) == 0 && strings.EqualFold(fields[0], "address") {
+				continue
+			}
+			if len(fields) < 2 {
+				return nil, xerrors.Errorf("%s: row %d: expected address,amount", path, len(rows)+1)
+			}
+			rows = append(rows, row{Address: fields[0], Amount: payoutAmount(fields[1])})
+		}
+	}
+
+	var payouts []*Payout
+	var errs []string
+	for i, r := range rows {
+		if !common.IsHexAddress(r.Address) {
+			errs = append(errs, fmt.Sprintf("row %d: invalid address %q", i+1, r.Address))
+			continue
+		}
+		amount, err := parseAmount(string(r.Amount), units, unit)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("row %d: %s", i+1, err.Error()))
+			continue
+		}
+		if amount.Sign() == 0 {
+			errs = append(errs, fmt.Sprintf("row %d: zero amount", i+1))
+			continue
+		}
+		payouts = append(payouts, &Payout{Row: i + 1, Address: common.HexToAddress(r.Address), Amount: amount, Text: strings.TrimSpace(string(r.Amount))})
+	}
+
+	if len(errs) > 0 {
+		return nil, xerrors.Errorf("invalid payouts file %s:\n%s", path, strings.Join(errs, "\n"))
+	}
+	if len(payouts) == 0 {
+		return nil, xerrors.Errorf("%s: no payouts", path)
+	}
+	return payouts, nil
+}
+
+// payoutAmount JSON 付款文件中的金额，可以是字符串（如 "1.5eth"）或数字（如 1.5），数字按原文精确解析。
+type payoutAmount string
+
+func (a *payoutAmount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = payoutAmount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*a = payoutAmount(n)
+	return nil
+}
+
+var batchHeader = []string{"row", "address", "amount", "nonce", "hash", "status", "gasUsed", "raw", "error"}
+
+// batchJournal 只追加写入的结果文件，每次写入后立即同步到磁盘。
+type batchJournal struct {
+	f       *os.File
+	w       *csv.Writer
+	records map[int]*batchRecord
+	order   []int
+}
+
+// readOnly 时只读取已有的记录，不创建也不写入结果文件。
+func openBatchJournal(path string, readOnly bool) (*batchJournal, error) {
+	j := &batchJournal{records: make(map[int]*batchRecord)}
+
+	if f, err := os.Open(path); err == nil {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = len(batchHeader)
+		all, err := r.ReadAll()
+		f.Close()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", path, err)
+		}
+		for i, fields := range all {
+			if i == 0 {
+				continue
+			}
+			record, err := parseBatchRecord(fields)
+			if err != nil {
+				return nil, xerrors.Errorf("%s:%d: %w", path, i+1, err)
+			}
+			j.remember(record)
+		}
+	}
+
+	if readOnly {
+		return j, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j.f, j.w = f, csv.NewWriter(f)
+
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if err := j.write(batchHeader); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+func parseBatchRecord(fields []string) (*batchRecord, error) {
+	row, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := strconv.ParseUint(fields[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	gasUsed, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &batchRecord{
+		Row:     row,
+		Address: fields[1],
+		Amount:  fields[2],
+		Nonce:   nonce,
+		Hash:    fields[4],
+		Status:  fields[5],
+		GasUsed: gasUsed,
+		Raw:     fields[7],
+		Error:   fields[8],
+	}, nil
+}
+
+func (j *batchJournal) remember(record *batchRecord) {
+	if _, ok := j.records[record.Row]; !ok {
+		j.order = append(j.order, record.Row)
+	}
+	j.records[record.Row] = record
+}
+
+// Append 追加一条记录并同步到磁盘。
+func (j *batchJournal) Append(record *batchRecord) error {
+	copied := *record
+	j.remember(&copied)
+
+	return j.write([]string{
+		strconv.Itoa(record.Row),
+		record.Address,
+		record.Amount,
+		strconv.FormatUint(record.Nonce, 10),
+		record.Hash,
+		record.Status,
+		strconv.FormatUint(record.GasUsed, 10),
+		record.Raw,
+		record.Error,
+	})
+}
+
+func (j *batchJournal) write(fields []string) error {
+	if j.w == nil {
+		return nil
+	}
+	if err := j.w.Write(fields); err != nil {
+		return err
+	}
+	j.w.Flush()
+	if err := j.w.Error(); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Records 按首次出现的顺序返回每一行的最新记录。
+func (j *batchJournal) Records() []*batchRecord {
+	var out []*batchRecord
+	for _, row := range j.order {
+		out = append(out, j.records[row])
+	}
+	return out
+}
+
+func (j *batchJournal) PrintSummary() error {
+	counts := make(map[string]int)
+	var rows []map[string]interface{}
+	for _, record := range j.Records() {
+		counts[record.Status]++
+		rows = append(rows, map[string]interface{}{
+			"row":     record.Row,
+			"address": record.Address,
+			"amount":  record.Amount,
+			"nonce":   record.Nonce,
+			"hash":    record.Hash,
+			"status":  record.Status,
+			"gasUsed": record.GasUsed,
+			"error":   record.Error,
+		})
+	}
+
+	result := map[string]interface{}{
+		"rows":     rows,
+		"mined":    counts[batchMined],
+		"reverted": counts[batchReverted],
+		"pending":  counts[batchSent] + counts[batchSigned],
+		"failed":   counts[batchFailed],
+		"replaced": counts[batchReplaced],
+	}
+	return printResult(result, func() {
+		for _, record := range j.Records() {
+			fmt.Printf("row %d\t%s\t%s\tnonce %d\t%s\t%s\tgas used %d\n",
+				record.Row, record.Address, record.Amount, record.Nonce, record.Hash, record.Status, record.GasUsed)
+		}
+		fmt.Printf("mined: %d, reverted: %d, pending: %d, failed: %d, replaced: %d\n",
+			counts[batchMined], counts[batchReverted], counts[batchSent]+counts[batchSigned], counts[batchFailed], counts[batchReplaced])
+	})
+}
+
+func (j *batchJournal) Close() error {
+	if j.f == nil {
+		return nil
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"geth-cli/jsonrpc"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/naoina/toml"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// Config 配置文件，默认位于 ~/.config/geth-cli/config.toml。
+type Config struct {
+	Network  string              `toml:"network" json:"network"`
+	Networks map[string]*Profile `toml:"networks" json:"networks"`
+}
+
+// Profile 一个网络的配置。
+type Profile struct {
+	RPC      []string          `toml:"rpc" json:"rpc"`
+	ChainID  uint64            `toml:"chain_id" json:"chainId"` // 0 表示不检查
+	Keystore string            `toml:"keystore" json:"keystore"`
+	Tokens   map[string]string `toml:"tokens" json:"tokens"`
+	Gas      GasConfig         `toml:"gas" json:"gas"`
+}
+
+// GasConfig 网络默认的手续费策略，命令行参数优先。
+type GasConfig struct {
+	Legacy               bool   `toml:"legacy" json:"legacy"`
+	NGasPrice            uint64 `toml:"n_gas_price" json:"nGasPrice"`
+	MaxFeePerGas         Gwei   `toml:"max_fee_per_gas,omitempty" json:"maxFeePerGas"`
+	MaxPriorityFeePerGas Gwei   `toml:"max_priority_fee_per_gas,omitempty" json:"maxPriorityFeePerGas"`
+}
+
+// ErrChainIDMismatch 节点的 chain id 与配置不一致。
+var ErrChainIDMismatch = xerrors.New("chain id mismatch")
+
+// profile 当前选择的网络配置。
+var profile = &Profile{}
+
+const defaultNetwork = "goerli"
+
+// defaultConfig 内置的网络配置，配置文件中的同名网络会整体覆盖它们。
+func defaultConfig() *Config {
+	return &Config{
+		Network: defaultNetwork,
+		Networks: map[string]*Profile{
+			"mainnet": {
+				RPC:     []string{"https://cloudflare-eth.com"},
+				ChainID: 1,
+				Tokens:  map[string]string{"bzz": "0x19062190B1925b5b6689D7073fDfC8c2976EF8Cb"},
+				Gas:     GasConfig{NGasPrice: 2},
+			},
+			"goerli": {
+				RPC:     []string{goerliEndPoint},
+				ChainID: 5,
+				Tokens:  map[string]string{"bzz": bzzTokenAddress, "gbzz": bzzTokenAddress},
+				Gas:     GasConfig{NGasPrice: 2},
+			},
+			"xdai": {
+				RPC:     []string{"https://rpc.xdaichain.com"},
+				ChainID: 100,
+				Tokens:  map[string]string{"bzz": "0xdBF3Ea6F5beE45c02255B2c26a16F300502F68da", "xbzz": "0xdBF3Ea6F5beE45c02255B2c26a16F300502F68da"},
+				Gas:     GasConfig{Legacy: true, NGasPrice: 1},
+			},
+			"local": {
+				RPC:     []string{"http://127.0.0.1:8545"},
+				ChainID: 1337,
+				Gas:     GasConfig{NGasPrice: 2},
+			},
+		},
+	}
+}
+
+var configFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "config",
+		Value: defaultConfigPath(),
+		Usage: "the TOML config file with the network profiles",
+	},
+	&cli.StringFlag{
+		Name:  "network",
+		Value: "",
+		Usage: "the network profile to use: mainnet, goerli, xdai, local or one from the config file",
+	},
+	&cli.Uint64Flag{
+		Name:  "chain-id",
+		Value: 0,
+		Usage: "refuse to sign unless the endpoint reports this chain id (default the profile's chain_id)",
+	},
+}
+
+var configCmd = &cli.Command{
+	Name:  "config",
+	Usage: "show or change the config file",
+	Subcommands: []*cli.Command{
+		configShowCmd,
+		configSetCmd,
+	},
+}
+
+var configShowCmd = &cli.Command{
+	Name:  "show",
+	Usage: "print the effective config",
+	Action: func(c *cli.Context) error {
+		cfg, err := loadConfig(c.String("config"))
+		if err != nil {
+			return err
+		}
+
+		out, err := toml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+
+		result := map[string]interface{}{
+			"config":   c.String("config"),
+			"network":  networkName(c, cfg),
+			"endpoint": defaultEndPoint,
+			"networks": cfg.Networks,
+		}
+		return printResult(result, func() {
+			fmt.Printf("# %s\n# using network %s, endpoint %s\n\n%s", c.String("config"), networkName(c, cfg), defaultEndPoint, out)
+		})
+	},
+}
+
+var configSetCmd = &cli.Command{
+	Name:      "set",
+	Usage:     "set a config value and save the config file",
+	ArgsUsage: "<network | networks.<name>.rpc | .chain_id | .keystore | .tokens.<alias> | .gas.<field>> <value>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return xerrors.New("expected a key and a value")
+		}
+
+		path := c.String("config")
+		cfg, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.Set(c.Args().Get(0), c.Args().Get(1)); err != nil {
+			return err
+		}
+
+		out, err := toml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, out, 0600)
+	},
+}
+
+// Set 修改一个配置项，key 形如 network 或 networks.goerli.gas.n_gas_price。
+func (cfg *Config) Set(key, value string) error {
+	if key == "network" {
+		if _, ok := cfg.Networks[value]; !ok {
+			return xerrors.Errorf("unknown network: %s", value)
+		}
+		cfg.Network = value
+		return nil
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) < 3 || parts[0] != "networks" {
+		return xerrors.Errorf("unknown config key: %s", key)
+	}
+
+	p, ok := cfg.Networks[parts[1]]
+	if !ok {
+		p = &Profile{}
+		cfg.Networks[parts[1]] = p
+	}
+
+	var err error
+	switch field := strings.Join(parts[2:], "."); {
+	case field == "rpc":
+		p.RPC = strings.Split(value, ",")
+	case field == "chain_id":
+		p.ChainID, err = strconv.ParseUint(value, 10, 64)
+	case field == "keystore":
+		p.Keystore = value
+	case strings.HasPrefix(field, "tokens.") && len(parts) == 4:
+		if p.Tokens == nil {
+			p.Tokens = make(map[string]string)
+		}
+		p.Tokens[strings.ToLower(parts[3])] = value
+	case field == "gas.legacy":
+		p.Gas.Legacy, err = strconv.ParseBool(value)
+	case field == "gas.n_gas_price":
+		p.Gas.NGasPrice, err = strconv.ParseUint(value, 10, 64)
+	case field == "gas.max_fee_per_gas":
+		err = p.Gas.MaxFeePerGas.UnmarshalText([]byte(value))
+	case field == "gas.max_priority_fee_per_gas":
+		err = p.Gas.MaxPriorityFeePerGas.UnmarshalText([]byte(value))
+	default:
+		return xerrors.Errorf("unknown config key: %s", key)
+	}
+	if err != nil {
+		return xerrors.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "config.toml"
+	}
+	return filepath.Join(dir, "geth-cli", "config.toml")
+}
+
+// loadConfig 读取配置文件并补上内置网络，文件不存在时只使用内置网络。
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fileCfg Config
+	if err := toml.Unmarshal(data, &fileCfg); err != nil {
+		return nil, xerrors.Errorf("%s: %w", path, err)
+	}
+
+	if fileCfg.Network != "" {
+		cfg.Network = fileCfg.Network
+	}
+	for name, p := range fileCfg.Networks {
+		cfg.Networks[name] = p
+	}
+	return cfg, nil
+}
+
+func networkName(c *cli.Context, cfg *Config) string {
+	if name := c.String("network"); name != "" {
+		return name
+	}
+	return cfg.Network
+}
+
+// setupNetwork 在执行命令前加载配置并切换到选择的网络，环境变量 ENDPOINT 优先于配置中的 rpc。
+// 这里不连接节点，config、account、tx sign 等离线命令在节点不可用时也能执行，见 connectNode。
+func setupNetwork(c *cli.Context) error {
+	cfg, err := loadConfig(c.String("config"))
+	if err != nil {
+		return err
+	}
+
+	name := networkName(c, cfg)
+	p, ok := cfg.Networks[name]
+	if !ok {
+		var names []string
+		for n := range cfg.Networks {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return xerrors.Errorf("unknown network %s, expected one of %s", name, strings.Join(names, ", "))
+	}
+	profile = p
+	dryRun = c.Bool("dry-run")
+	if err := setOutputFormat(c.String("output")); err != nil {
+		return err
+	}
+	if c.IsSet("chain-id") {
+		pinned := *p
+		pinned.ChainID = c.Uint64("chain-id")
+		profile = &pinned
+	} else if os.Getenv("ENDPOINT") != "" && !c.IsSet("network") {
+		// ENDPOINT 指向的节点不一定属于默认网络，只有用 --network 明确选择网络时才检查它的 chain_id
+		unpinned := *p
+		unpinned.ChainID = 0
+		profile = &unpinned
+	}
+
+	// 没有配置代币的网络也要清空别名，否则 bzz 会解析为默认网络上的合约地址
+	tokenAliases = make(map[string]string, len(p.Tokens))
+	for alias, address := range p.Tokens {
+		tokenAliases[strings.ToLower(alias)] = address
+	}
+
+	if endpoint := os.Getenv("ENDPOINT"); endpoint != "" {
+		defaultEndPoint = endpoint
+	} else if len(p.RPC) > 0 {
+		defaultEndPoint = p.RPC[0]
+	}
+	return nil
+}
+
+// connectNode 在访问节点的命令执行前选择可以连接的 rpc 并创建 client。
+func connectNode(c *cli.Context) error {
+	if os.Getenv("ENDPOINT") == "" && len(profile.RPC) > 1 {
+		defaultEndPoint = selectEndpoint(profile.RPC)
+	}
+
+	var err error
+	client, err = jsonrpc.NewEthClient(defaultEndPoint)
+	return err
+}
+
+// selectEndpoint 配置了多个 rpc 时返回第一个可以连接的地址。
+func selectEndpoint(urls []string) string {
+	if len(urls) == 1 {
+		return urls[0]
+	}
+
+	for _, url := range urls {
+		probe, err := jsonrpc.NewEthClient(url)
+		if err != nil {
+			continue
+		}
+		probe.Retries = 0
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err = probe.EthRpcNetVersion(ctx)
+		probe.Close()
+		cancel()
+		if err == nil {
+			return url
+		}
+	}
+	return urls[0]
+}
+
+// signingChainID 通过 eth_chainId 查询签名使用的 chain id，与配置中固定的 chain id 不一致时拒绝签名。
+// net_version 返回的是网络 id，在 ETC 和部分 L2 上与 chain id 不同，不能用于签名。
+func signingChainID(ctx context.Context, client *ethclient.Client) (*big.Int, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("eth_chainId: %w", err)
+	}
+
+	if expected := profile.ChainID; expected != 0 && (!chainID.IsUint64() || chainID.Uint64() != expected) {
+		return nil, xerrors.Errorf("endpoint %s reports chain id %s but %d is expected, check --network/--chain-id: %w",
+			defaultEndPoint, chainID, expected, ErrChainIDMismatch)
+	}
+	return chainID, nil
+}
+
+// keystoreDir 返回 --keystore 参数，未指定时使用网络配置中的目录。
+func keystoreDir(c *cli.Context) string {
+	if c.IsSet("keystore") || profile.Keystore == "" {
+		return c.String("keystore")
+	}
+
+	dir := profile.Keystore
+	if strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[2:])
+		}
+	}
+	return dir
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strings"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// dryRun 为 true 时交易签名后只做模拟，不广播。由全局参数 --dry-run 设置。
+var dryRun bool
+
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Value: false,
+	Usage: "build, sign and simulate transactions (eth_call, eth_estimateGas) but never broadcast them",
+}
+
+// sendTransaction 广播已签名的交易，--dry-run 时改为模拟执行并打印交易内容。
+func sendTransaction(ctx context.Context, client *ethclient.Client, tx *types.Transaction) error {
+	if dryRun {
+		return simulateTx(ctx, client, tx)
+	}
+	return client.SendTransaction(ctx, tx)
+}
+
+// logTxSent 打印交易已发送，--dry-run 时说明交易没有广播。
+func logTxSent(kind string, tx *types.Transaction) {
+	if dryRun {
+		log.Printf("%s tx %s not sent (dry run)", kind, tx.Hash().Hex())
+		return
+	}
+	log.Printf("%s tx sent: %s", kind, tx.Hash().Hex())
+}
+
+// simulateTx 在 pending 状态上执行 eth_call 和 eth_estimateGas，并打印交易的内容、费用上限和签名后的原始数据。
+func simulateTx(ctx context.Context, client *ethclient.Client, tx *types.Transaction) error {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var info *TokenInfo
+	if len(tx.Data()) > 0 {
+		info = lookupTokenInfo(*tx.To())
+	}
+
+	fmt.Fprintf(textOut(), "dry run, transaction not broadcast\n")
+	printTxIntent(from, tx.ChainId(), tx, info)
+
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Value: tx.Value(), Data: tx.Data()}
+	estimate, estimateErr := client.EstimateGas(ctx, msg)
+	if estimateErr != nil {
+		fmt.Fprintf(textOut(), "  estimate:   failed: %s\n", payments.RevertReason(estimateErr))
+	} else {
+		fmt.Fprintf(textOut(), "  estimate:   %d gas\n", estimate)
+	}
+
+	msg.Gas = tx.Gas()
+	if tx.Type() == types.LegacyTxType {
+		msg.GasPrice = tx.GasPrice()
+	} else {
+		msg.GasFeeCap, msg.GasTipCap = tx.GasFeeCap(), tx.GasTipCap()
+	}
+	_, callErr := client.PendingCallContract(ctx, msg)
+	if callErr != nil {
+		fmt.Fprintf(textOut(), "  eth_call:   failed: %s\n", payments.RevertReason(callErr))
+	} else {
+		fmt.Fprintf(textOut(), "  eth_call:   ok\n")
+	}
+
+	fmt.Fprintf(textOut(), "  hash:       %s\n", tx.Hash().Hex())
+	fmt.Fprintf(textOut(), "  raw:        %s\n", hexutil.Encode(raw))
+
+	switch {
+	case callErr != nil:
+		return payments.SimulationError("eth_call", callErr)
+	case estimateErr == nil && estimate > tx.Gas():
+		return xerrors.Errorf("gas limit %d is below the estimate %d: %w", tx.Gas(), estimate, payments.ErrTxSimulationFailed)
+	}
+	return nil
+}
+
+// printTxIntent 打印交易的收款方、金额、手续费上限和总花费，签名和模拟前供用户核对。
+// info 不为空时按代币单位显示代币调用中的金额。
+func printTxIntent(from common.Address, chainID *big.Int, tx *types.Transaction, info *TokenInfo) {
+	printTxIntentTo(textOut(), from, chainID, tx, info)
+}
+
+func printTxIntentTo(w io.Writer, from common.Address, chainID *big.Int, tx *types.Transaction, info *TokenInfo) {
+	price := tx.GasFeeCap()
+	fees := fmt.Sprintf("maxFeePerGas: %s Gwei, maxPriorityFeePerGas: %s Gwei", formatDecimal(tx.GasFeeCap(), 9), formatDecimal(tx.GasTipCap(), 9))
+	if tx.Type() == types.LegacyTxType {
+		price = tx.GasPrice()
+		fees = fmt.Sprintf("gasPrice: %s Gwei", formatDecimal(price, 9))
+	}
+	maxFee := new(big.Int).Mul(price, new(big.Int).SetUint64(tx.Gas()))
+
+	fmt.Fprintf(w, "  from:       %s\n", from.Hex())
+	fmt.Fprintf(w, "  to:         %s\n", tx.To().Hex())
+	fmt.Fprintf(w, "  value:      %s eth\n", formatDecimal(tx.Value(), 18))
+	if len(tx.Data()) > 0 {
+		fmt.Fprintf(w, "  call:       %s\n", describeCall(tx.Data(), info))
+	}
+	fmt.Fprintf(w, "  chain id:   %s\n", chainID)
+	fmt.Fprintf(w, "  nonce:      %d\n", tx.Nonce())
+	fmt.Fprintf(w, "  gas limit:  %d\n", tx.Gas())
+	fmt.Fprintf(w, "  fees:       %s\n", fees)
+	fmt.Fprintf(w, "  max fee:    %s eth\n", formatDecimal(maxFee, 18))
+	fmt.Fprintf(w, "  max cost:   %s eth\n", formatDecimal(new(big.Int).Add(maxFee, tx.Value()), 18))
+}
+
+// lookupTokenInfo 读取合约的代币信息，不是代币合约或查询失败时返回 nil。
+func lookupTokenInfo(address common.Address) *TokenInfo {
+	client, err := ethclient.Dial(defaultEndPoint)
+	if err != nil {
+		return nil
+	}
+	info, err := LoadTokenInfo(client, address)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// describeCall 解码代币合约的 transfer、approve、transferFrom 调用，info 不为空时金额按代币单位显示。
+func describeCall(data []byte, info *TokenInfo) string {
+	if len(data) < 4 {
+		return hexutil.Encode(data)
+	}
+
+	method, err := tokenABI.MethodById(data[:4])
+	if err != nil {
+		return fmt.Sprintf("unknown method %s", hexutil.Encode(data[:4]))
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return fmt.Sprintf("%s (undecodable arguments: %s)", method.Name, err)
+	}
+
+	var parts []string
+	for i, input := range method.Inputs {
+		value := fmt.Sprint(args[i])
+		switch v := args[i].(type) {
+		case common.Address:
+			value = v.Hex()
+		case *big.Int:
+			if info != nil {
+				value = fmt.Sprintf("%s %s", formatDecimal(v, info.Decimals), info.Symbol)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", input.Name, value))
+	}
+	return fmt.Sprintf("%s(%s)", method.Name, strings.Join(parts, ", "))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"geth-cli/payments"
+
+	"golang.org/x/xerrors"
+)
+
+// 进程的退出码，脚本可以据此区分失败的原因，README 中有说明。
+const (
+	exitError             = 1
+	exitRPCUnavailable    = 3
+	exitChainIDMismatch   = 4
+	exitInsufficientFunds = 5
+	exitNonceTooLow       = 6
+	exitUnderpriced       = 7
+	exitReverted          = 8
+	exitNotMined          = 9
+)
+
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{payments.ErrRPCUnavailable, exitRPCUnavailable},
+	{ErrChainIDMismatch, exitChainIDMismatch},
+	{payments.ErrInsufficientFunds, exitInsufficientFunds},
+	{payments.ErrNonceTooLow, exitNonceTooLow},
+	{payments.ErrUnderpriced, exitUnderpriced},
+	{payments.ErrTxSimulationFailed, exitReverted},
+	{ErrTxReverted, exitReverted},
+	{ErrTxReplaced, exitNotMined},
+	{ErrTxDropped, exitNotMined},
+	{ErrTxTimeout, exitNotMined},
+}
+
+// exitCode 返回错误对应的退出码，err 先经过 payments.ClassifyError 判断节点返回的错误类型。
+func exitCode(err error) int {
+	err = payments.ClassifyError(err)
+	for _, e := range exitCodes {
+		if xerrors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return exitError
+}
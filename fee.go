@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/big"
+
+	"geth-cli/payments"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// feeFlags 手续费相关参数，默认根据最新区块的 baseFee 构造 EIP-1559 交易。
+var feeFlags = []cli.Flag{
+	&cli.Uint64Flag{
+		Name:  "nGasPrice",
+		Value: 2, // in units
+		Usage: "n times of the current gas price (legacy) or base fee (EIP-1559)",
+	},
+	&cli.StringFlag{
+		Name:  "maxFeePerGas",
+		Value: "",
+		Usage: "the max fee per gas (Gwei), default nGasPrice * baseFee + maxPriorityFeePerGas",
+	},
+	&cli.StringFlag{
+		Name:  "maxPriorityFeePerGas",
+		Value: "",
+		Usage: "the max priority fee per gas (Gwei), default eth_maxPriorityFeePerGas",
+	},
+	&cli.BoolFlag{
+		Name:  "legacy",
+		Value: false,
+		Usage: "send a legacy transaction priced by gasPrice for chains without EIP-1559",
+	},
+	&cli.Uint64Flag{
+		Name:  "gasMargin",
+		Value: 20,
+		Usage: "percent added to the gas estimate when no --gasLimit is given",
+	},
+}
+
+// feeOptionsFromContext 读取手续费参数，未指定的参数使用网络配置中的默认值。
+func feeOptionsFromContext(c *cli.Context) (payments.FeeOptions, error) {
+	gas := profile.Gas
+	if c.IsSet("legacy") || !gas.Legacy {
+		gas.Legacy = c.Bool("legacy")
+	}
+	if c.IsSet("nGasPrice") || gas.NGasPrice == 0 {
+		gas.NGasPrice = c.Uint64("nGasPrice")
+	}
+	if c.IsSet("maxFeePerGas") {
+		gas.MaxFeePerGas = Gwei(c.String("maxFeePerGas"))
+	}
+	if c.IsSet("maxPriorityFeePerGas") {
+		gas.MaxPriorityFeePerGas = Gwei(c.String("maxPriorityFeePerGas"))
+	}
+
+	maxFee, err := gas.MaxFeePerGas.Wei()
+	if err != nil {
+		return payments.FeeOptions{}, xerrors.Errorf("maxFeePerGas: %w", err)
+	}
+	tip, err := gas.MaxPriorityFeePerGas.Wei()
+	if err != nil {
+		return payments.FeeOptions{}, xerrors.Errorf("maxPriorityFeePerGas: %w", err)
+	}
+
+	return payments.FeeOptions{
+		Legacy:               gas.Legacy,
+		NGasPrice:            gas.NGasPrice,
+		MaxFeePerGas:         maxFee,
+		MaxPriorityFeePerGas: tip,
+		GasMargin:            c.Uint64("gasMargin"),
+	}, nil
+}
+
+// Gwei 以 Gwei 为单位的十进制数，按字符串精确转换，配置文件中写成数字或字符串都可以。
+type Gwei string
+
+func (g *Gwei) UnmarshalText(text []byte) error {
+	if _, err := Gwei(text).Wei(); err != nil {
+		return err
+	}
+	*g = Gwei(text)
+	return nil
+}
+
+// Wei 转换为 wei，为空或为 0 时返回 nil，表示使用默认值。
+func (g Gwei) Wei() (*big.Int, error) {
+	if g == "" {
+		return nil, nil
+	}
+	wei, err := parseDecimal(string(g), 9)
+	if err != nil || wei.Sign() == 0 {
+		return nil, err
+	}
+	return wei, nil
+}
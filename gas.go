@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// estimateGas 见 payments.EstimateGas，使用估算值时输出估算值和余量。
+func estimateGas(ctx context.Context, client *ethclient.Client, msg ethereum.CallMsg, gasLimit, margin uint64) (uint64, error) {
+	limit, estimate, err := payments.EstimateGas(ctx, client, msg, gasLimit, margin)
+	if err == nil && gasLimit == 0 {
+		log.Printf("gas estimate: %d, limit with %d%% margin: %d", estimate, margin, limit)
+	}
+	return limit, err
+}
@@ -3,10 +3,12 @@ module geth-cli
 go 1.15
 
 require (
-	github.com/ethereum/go-ethereum v1.10.3
-	github.com/parnurzeal/gorequest v0.2.16
+	github.com/ethereum/go-ethereum v1.10.8
+	github.com/gorilla/websocket v1.4.2
+	github.com/naoina/toml v0.1.2-0.20170918210437-9fafd6967416
+	github.com/tyler-smith/go-bip39 v1.0.1-0.20181017060643-dbb3b84ba2ef
 	github.com/urfave/cli/v2 v2.3.0
 	golang.org/x/crypto v0.0.0-20210506145944-38f3c27a63bf
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
-	moul.io/http2curl v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
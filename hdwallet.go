@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var mnemonicFileFlag = &cli.StringFlag{
+	Name:  "mnemonic-file",
+	Value: "",
+	Usage: "read the BIP-39 mnemonic from this file",
+}
+
+// hdRangeFlag 派生地址的路径，{a..b} 展开为 a 到 b 的每个序号。
+var hdRangeFlag = &cli.StringFlag{
+	Name:  "path",
+	Value: "m/44'/60'/0'/0/{0..9}",
+	Usage: "the BIP-44 derivation path, {a..b} derives every index from a to b (at most 10000)",
+}
+
+// hdKeyFlags 从助记词派生出账私钥的参数，见 loadKey。
+var hdKeyFlags = []cli.Flag{
+	mnemonicFileFlag,
+	&cli.IntFlag{
+		Name:  "from-index",
+		Value: 0,
+		Usage: "sign with the key derived at this index of --hd-path from --mnemonic-file",
+	},
+	&cli.StringFlag{
+		Name:  "hd-path",
+		Value: "m/44'/60'/0'/0",
+		Usage: "the BIP-44 derivation path that --from-index is appended to",
+	},
+}
+
+var accountDeriveCmd = &cli.Command{
+	Name:  "derive",
+	Usage: "list the addresses derived from a BIP-39 mnemonic",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "mnemonic-file",
+			Value:    "",
+			Required: true,
+			Usage:    "read the BIP-39 mnemonic from this file",
+		},
+		hdRangeFlag,
+	},
+	Action: func(c *cli.Context) error {
+		derived, err := deriveAccounts(c.String("mnemonic-file"), c.String("path"))
+		if err != nil {
+			return err
+		}
+		return printResult(derived, func() {
+			for _, account := range derived {
+				fmt.Printf("#%d: %s %s\n", account.Index, account.Address.Hex(), account.Path)
+			}
+		})
+	},
+}
+
+// DerivedAccount 从助记词派生的一个账户，Index 为路径中展开的序号。
+type DerivedAccount struct {
+	Index   uint64         `json:"index"`
+	Path    string         `json:"path"`
+	Address common.Address `json:"address"`
+
+	key *ecdsa.PrivateKey
+}
+
+// deriveAccounts 展开 pathRange 并派生每个路径的私钥和地址。
+func deriveAccounts(mnemonicFile, pathRange string) ([]*DerivedAccount, error) {
+	seed, err := readMnemonicSeed(mnemonicFile)
+	if err != nil {
+		return nil, err
+	}
+	paths, indexes, err := expandHDPath(pathRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var derived []*DerivedAccount
+	for i, path := range paths {
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", path, err)
+		}
+		derived = append(derived, &DerivedAccount{
+			Index:   indexes[i],
+			Path:    path.String(),
+			Address: crypto.PubkeyToAddress(key.PublicKey),
+			key:     key,
+		})
+	}
+	return derived, nil
+}
+
+// loadDerivedKey 派生 --hd-path/--from-index 的私钥。
+func loadDerivedKey(c *cli.Context) (*ecdsa.PrivateKey, error) {
+	if c.Int("from-index") < 0 {
+		return nil, xerrors.Errorf("--from-index must not be negative: %d", c.Int("from-index"))
+	}
+	path, err := accounts.ParseDerivationPath(fmt.Sprintf("%s/%d", strings.TrimSuffix(c.String("hd-path"), "/"), c.Int("from-index")))
+	if err != nil {
+		return nil, xerrors.Errorf("--hd-path: %w", err)
+	}
+	seed, err := readMnemonicSeed(c.String("mnemonic-file"))
+	if err != nil {
+		return nil, err
+	}
+	return deriveKey(seed, path)
+}
+
+// readMnemonicSeed 读取助记词文件，检查校验和并转换为 BIP-39 种子。
+func readMnemonicSeed(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mnemonic := strings.Join(strings.Fields(string(data)), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, xerrors.Errorf("%s: invalid mnemonic: %w", path, err)
+	}
+	return seed, nil
+}
+
+var hdRangePattern = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// maxHDRange {a..b} 最多展开的地址数，每个地址都要派生私钥，过大的范围会长时间占用 CPU 和内存。
+const maxHDRange = 10000
+
+// expandHDPath 把路径中的 {a..b} 展开为多个路径，返回路径和每个路径展开的序号。
+// 没有 {a..b} 时返回一个路径，序号为路径的最后一级。
+func expandHDPath(pathRange string) ([]accounts.DerivationPath, []uint64, error) {
+	matches := hdRangePattern.FindAllStringSubmatchIndex(pathRange, -1)
+	if len(matches) > 1 {
+		return nil, nil, xerrors.Errorf("path %s: only one {a..b} range is allowed", pathRange)
+	}
+	if len(matches) == 0 {
+		path, err := accounts.ParseDerivationPath(pathRange)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("path %s: %w", pathRange, err)
+		}
+		return []accounts.DerivationPath{path}, []uint64{uint64(path[len(path)-1] &^ 0x80000000)}, nil
+	}
+
+	m := matches[0]
+	from, err := strconv.ParseUint(pathRange[m[2]:m[3]], 10, 31)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("path %s: %w", pathRange, err)
+	}
+	to, err := strconv.ParseUint(pathRange[m[4]:m[5]], 10, 31)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("path %s: %w", pathRange, err)
+	}
+	if from > to {
+		return nil, nil, xerrors.Errorf("path %s: empty range", pathRange)
+	}
+	if to-from >= maxHDRange {
+		return nil, nil, xerrors.Errorf("path %s: the range has %d indexes, at most %d are allowed", pathRange, to-from+1, maxHDRange)
+	}
+
+	var paths []accounts.DerivationPath
+	var indexes []uint64
+	for i := from; i <= to; i++ {
+		s := pathRange[:m[0]] + strconv.FormatUint(i, 10) + pathRange[m[1]:]
+		path, err := accounts.ParseDerivationPath(s)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("path %s: %w", s, err)
+		}
+		paths = append(paths, path)
+		indexes = append(indexes, i)
+	}
+	return paths, indexes, nil
+}
+
+// deriveKey 按 BIP-32 从种子派生 path 的私钥。
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	n := crypto.S256().Params().N
+	key, chainCode, err := hdChild(n, []byte("Bitcoin seed"), seed, new(big.Int))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, math.PaddedBigBytes(key, 32)...)
+		} else {
+			parent, err := crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		if key, chainCode, err = hdChild(n, chainCode, data, key); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+}
+
+// hdChild 计算 HMAC-SHA512(chainCode, data)，返回 parent 加前 32 字节的私钥和后 32 字节的 chain code。
+func hdChild(n *big.Int, chainCode, data []byte, parent *big.Int) (*big.Int, []byte, error) {
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, nil, xerrors.New("invalid derived key, use the next index")
+	}
+	key := il.Add(il, parent).Mod(il, n)
+	if key.Sign() == 0 {
+		return nil, nil, xerrors.New("invalid derived key, use the next index")
+	}
+	return key, sum[32:], nil
+}
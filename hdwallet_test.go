@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func writeMnemonic(t *testing.T, mnemonic string) string {
+	path := filepath.Join(t.TempDir(), "mnemonic.txt")
+	if err := ioutil.WriteFile(path, []byte(mnemonic+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// MetaMask、Ledger 和 Hardhat 对同一助记词派生的地址。
+func TestDeriveKey(t *testing.T) {
+	for _, tt := range []struct {
+		mnemonic string
+		path     string
+		address  string
+	}{
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "m/44'/60'/0'/0/0", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{"test test test test test test test test test test test junk", "m/44'/60'/0'/0/0", "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"},
+		{"test test test test test test test test test test test junk", "m/44'/60'/0'/0/1", "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"},
+	} {
+		seed, err := readMnemonicSeed(writeMnemonic(t, tt.mnemonic))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := accounts.ParseDerivationPath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if address := crypto.PubkeyToAddress(key.PublicKey); address != common.HexToAddress(tt.address) {
+			t.Errorf("%s at %s: %s, want %s", tt.mnemonic, tt.path, address.Hex(), tt.address)
+		}
+	}
+}
+
+func TestReadMnemonicSeedChecksum(t *testing.T) {
+	if _, err := readMnemonicSeed(writeMnemonic(t, "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")); err == nil {
+		t.Error("accepted a mnemonic with a wrong checksum")
+	}
+}
+
+func TestExpandHDPath(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		paths   []string
+		indexes []uint64
+	}{
+		{"m/44'/60'/0'/0/7", []string{"m/44'/60'/0'/0/7"}, []uint64{7}},
+		{"m/44'/60'/0'/0/{0..2}", []string{"m/44'/60'/0'/0/0", "m/44'/60'/0'/0/1", "m/44'/60'/0'/0/2"}, []uint64{0, 1, 2}},
+		{"m/44'/60'/{3..4}'/0/0", []string{"m/44'/60'/3'/0/0", "m/44'/60'/4'/0/0"}, []uint64{3, 4}},
+		{"m/44'/60'/0'/0/{5..5}", []string{"m/44'/60'/0'/0/5"}, []uint64{5}},
+	} {
+		paths, indexes, err := expandHDPath(tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		var got []string
+		for _, path := range paths {
+			got = append(got, path.String())
+		}
+		if !reflect.DeepEqual(got, tt.paths) || !reflect.DeepEqual(indexes, tt.indexes) {
+			t.Errorf("%s: %v %v, want %v %v", tt.path, got, indexes, tt.paths, tt.indexes)
+		}
+	}
+
+	for _, path := range []string{
+		"m/44'/60'/0'/0/{2..1}",
+		"m/44'/60'/{0..1}'/0/{0..1}",
+		"m/44'/60'/0'/0/x",
+		"m/44'/60'/0'/0/{0..4294967296}",
+		"m/44'/60'/0'/0/{0..2147483647}",
+		"m/44'/60'/0'/0/{100..10100}",
+	} {
+		if _, _, err := expandHDPath(path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+
+	if paths, _, err := expandHDPath("m/44'/60'/0'/0/{100..10099}"); err != nil || len(paths) != maxHDRange {
+		t.Errorf("a range of %d indexes: %d paths, %v", maxHDRange, len(paths), err)
+	}
+}
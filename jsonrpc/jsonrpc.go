@@ -1,146 +1,341 @@
 package jsonrpc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/parnurzeal/gorequest"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
-	c *gorequest.SuperAgent
+	t      Transport
+	nextID uint64
+
+	// Retries 传输错误、HTTP 429 和 5xx 时的重试次数，发送交易的请求只在确定没有送达节点时重试
+	Retries int
+	// Backoff 第一次重试前的等待时间，之后每次翻倍
+	Backoff time.Duration
 }
 
-// NewEthClient 获取eth客户端
-func NewEthClient(rawURI string) *Client {
-	c := gorequest.New().
-		Timeout(time.Minute * 5).
-		Post(rawURI)
-	return &Client{c}
+// NewEthClient 获取eth客户端，rawURI 可以是 http(s)://、ws(s):// 地址或 IPC 文件路径
+func NewEthClient(rawURI string) (*Client, error) {
+	t, err := NewTransport(rawURI)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(t), nil
+}
+
+// NewClient 使用指定的传输方式创建客户端
+func NewClient(t Transport) *Client {
+	return &Client{
+		t:       t,
+		Retries: 3,
+		Backoff: 500 * time.Millisecond,
+	}
+}
+
+// Close 关闭底层连接
+func (c *Client) Close() error {
+	return c.t.Close()
 }
 
 // StRpcRespError rpc 错误
 type StRpcRespError struct {
-	Code    int64  `json:"code"`
-	Message string `json:"message"`
+	Code    int64       `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 func (e *StRpcRespError) Error() string {
 	return fmt.Sprintf("%d %s", e.Code, e.Message)
 }
 
-// StEthTransaction 交易
+// ErrorCode 和 ErrorData 与 go-ethereum 的 rpc.Error、rpc.DataError 接口相同
+func (e *StRpcRespError) ErrorCode() int {
+	return int(e.Code)
+}
+
+func (e *StRpcRespError) ErrorData() interface{} {
+	return e.Data
+}
+
+// StEthTransaction 交易，EIP-1559 交易额外带有 maxFeePerGas 和 maxPriorityFeePerGas，
+// EIP-2930 和 EIP-1559 交易带有 chainId 和 accessList
 type StEthTransaction struct {
-	From             string      `json:"from"`
-	Gas              string      `json:"gas"`
-	GasPrice         string      `json:"gasPrice"`
-	Hash             string      `json:"hash"`
-	Input            string      `json:"input"`
-	Nonce            string      `json:"nonce"`
-	R                string      `json:"r"`
-	S                string      `json:"s"`
-	To               string      `json:"to"`
-	TransactionIndex interface{} `json:"transactionIndex"`
-	Type             string      `json:"type"`
-	V                string      `json:"v"`
-	Value            string      `json:"value"`
+	AccessList           json.RawMessage `json:"accessList,omitempty"`
+	ChainID              string          `json:"chainId,omitempty"`
+	From                 string          `json:"from"`
+	Gas                  string          `json:"gas"`
+	GasPrice             string          `json:"gasPrice"`
+	MaxFeePerGas         string          `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string          `json:"maxPriorityFeePerGas,omitempty"`
+	Hash                 string          `json:"hash"`
+	Input                string          `json:"input"`
+	Nonce                string          `json:"nonce"`
+	R                    string          `json:"r"`
+	S                    string          `json:"s"`
+	To                   string          `json:"to"`
+	TransactionIndex     interface{}     `json:"transactionIndex"`
+	Type                 string          `json:"type"`
+	V                    string          `json:"v"`
+	Value                string          `json:"value"`
 }
 
 // StRpcReq rpc请求
 type StRpcReq struct {
 	Jsonrpc string        `json:"jsonrpc"`
-	ID      string        `json:"id"`
+	ID      uint64        `json:"id"`
 	Method  string        `json:"method"`
 	Params  []interface{} `json:"params"`
 }
 
 // StRpcResp rpc返回
 type StRpcResp struct {
-	ID    string          `json:"id"`
-	Error *StRpcRespError `json:"error"`
-}
-
-// doReq 发送请求
-func (c *Client) doReq(method string, arqs []interface{}, resp interface{}) error {
-	_, body, errs := c.c.
-		Send(StRpcReq{
-			Jsonrpc: "1.0",
-			ID:      "1",
-			Method:  method,
-			Params:  arqs,
-		}).EndBytes()
-	if errs != nil {
-		return errs[0]
-	}
-	err := json.Unmarshal(body, resp)
+	ID     uint64          `json:"id"`
+	Error  *StRpcRespError `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// BatchElem 批量请求中的一个调用，Result 为解码目标，Error 为该调用自己的错误
+type BatchElem struct {
+	Method string
+	Params []interface{}
+	Result interface{}
+	Error  error
+}
+
+func (c *Client) newReq(method string, args []interface{}) StRpcReq {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return StRpcReq{
+		Jsonrpc: "2.0",
+		ID:      atomic.AddUint64(&c.nextID, 1),
+		Method:  method,
+		Params:  args,
+	}
+}
+
+// Call 发送一个请求并把 result 解码到 result 中
+func (c *Client) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	req := c.newReq(method, args)
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.roundTrip(ctx, payload, idempotent(method))
+	if err != nil {
+		return err
+	}
+
+	var resp StRpcResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	// 无法解析请求时节点返回 id 为 null 的错误，也属于这个请求
+	if resp.ID != req.ID && !(resp.ID == 0 && resp.Error != nil) {
+		return fmt.Errorf("%s: response id %d does not match request id %d", method, resp.ID, req.ID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return decodeResult(resp.Result, result)
+}
+
+// BatchCall 把多个请求放在一个数组中发送，按 id 匹配响应。
+// 只有整个批量请求失败时才返回错误，单个调用的错误写入对应的 BatchElem.Error。
+func (c *Client) BatchCall(ctx context.Context, batch []BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	reqs := make([]StRpcReq, len(batch))
+	index := make(map[uint64]int, len(batch))
+	retrySafe := true
+	for i, elem := range batch {
+		reqs[i] = c.newReq(elem.Method, elem.Params)
+		index[reqs[i].ID] = i
+		retrySafe = retrySafe && idempotent(elem.Method)
+	}
+
+	payload, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.roundTrip(ctx, payload, retrySafe)
 	if err != nil {
 		return err
 	}
+
+	// 节点无法处理批量请求时返回单个错误对象
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var resp StRpcResp
+		if err := json.Unmarshal(trimmed, &resp); err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return fmt.Errorf("batch: unexpected single response")
+	}
+
+	var resps []StRpcResp
+	if err := json.Unmarshal(body, &resps); err != nil {
+		return err
+	}
+
+	answered := make([]bool, len(batch))
+	for _, resp := range resps {
+		i, ok := index[resp.ID]
+		if !ok || answered[i] {
+			continue
+		}
+		answered[i] = true
+		if resp.Error != nil {
+			batch[i].Error = resp.Error
+			continue
+		}
+		batch[i].Error = decodeResult(resp.Result, batch[i].Result)
+	}
+	for i := range batch {
+		if !answered[i] {
+			batch[i].Error = fmt.Errorf("%s: no response in batch", batch[i].Method)
+		}
+	}
 	return nil
 }
 
+func decodeResult(raw json.RawMessage, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	if len(raw) == 0 {
+		return fmt.Errorf("empty result")
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// sendMethods 会广播交易的方法。超时或 502 时节点可能已经收到并广播了交易，
+// 重试会得到 "already known" 或 "nonce too low"，把已经成功的发送报告为失败。
+var sendMethods = map[string]bool{
+	"eth_sendRawTransaction":   true,
+	"eth_sendTransaction":      true,
+	"personal_sendTransaction": true,
+}
+
+func idempotent(method string) bool {
+	return !sendMethods[method]
+}
+
+// roundTrip 发送请求体，传输错误、HTTP 429 和 5xx 按指数退避重试。
+// idempotent 为 false 时只重试请求确定没有送达节点的错误：连接失败和 HTTP 429。
+func (c *Client) roundTrip(ctx context.Context, payload []byte, idempotent bool) ([]byte, error) {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		body, err := c.t.RoundTrip(ctx, payload)
+		if err == nil || attempt >= c.Retries || !retryable(ctx, err, idempotent) {
+			return body, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func retryable(ctx context.Context, err error, idempotent bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if !idempotent {
+			return httpErr.StatusCode == http.StatusTooManyRequests
+		}
+		return httpErr.Temporary()
+	}
+	if !idempotent {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	return true
+}
+
 // EthRpcNetVersion 获取block信息
 // "1": Ethereum Mainnet
 // "2": Morden Testnet (deprecated)
 // "3": Ropsten Testnet
 // "4": Rinkeby Testnet
 // "42": Kovan Testnet
-func (c *Client) EthRpcNetVersion() (int64, error) {
-	resp := struct {
-		StRpcResp
-		Result int64 `json:"result,string"`
-	}{}
-	err := c.doReq(
-		"net_version",
-		nil,
-		&resp,
-	)
-	if err != nil {
+func (c *Client) EthRpcNetVersion(ctx context.Context) (int64, error) {
+	var result string
+	if err := c.Call(ctx, &result, "net_version"); err != nil {
 		return 0, err
 	}
-	if resp.Error != nil {
-		return 0, resp.Error
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// StTxPoolStatus txpool_status 的结果，pending 和 queued 的交易数
+type StTxPoolStatus struct {
+	Pending uint64 `json:"pending"`
+	Queued  uint64 `json:"queued"`
+}
+
+// TxPoolStatus 交易池中 pending 和 queued 的交易数
+func (c *Client) TxPoolStatus(ctx context.Context) (*StTxPoolStatus, error) {
+	var result map[string]string
+	if err := c.Call(ctx, &result, "txpool_status"); err != nil {
+		return nil, err
 	}
-	return resp.Result, nil
+
+	status := &StTxPoolStatus{}
+	for name, count := range map[string]*uint64{"pending": &status.Pending, "queued": &status.Queued} {
+		n, err := strconv.ParseUint(strings.TrimPrefix(result[name], "0x"), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("txpool_status: invalid %s count %q", name, result[name])
+		}
+		*count = n
+	}
+	return status, nil
 }
 
-func (c *Client) TxPoolContent() (map[string]map[string]map[string]*StEthTransaction, error) {
-	resp := struct {
-		StRpcResp
-		Result map[string]map[string]map[string]*StEthTransaction `json:"result"`
-	}{}
-	err := c.doReq(
-		"txpool_content",
-		[]interface{}{},
-		&resp,
-	)
-	if err != nil {
+// TxPoolInspect 交易池中每笔交易的摘要，按 pending/queued、地址、nonce 分组，
+// 例如 "0xd46e8dd67c5d32be8058bb8eb970870f07244567: 1000 wei + 21000 gas × 1000000000 wei"
+func (c *Client) TxPoolInspect(ctx context.Context) (map[string]map[string]map[string]string, error) {
+	var result map[string]map[string]map[string]string
+	if err := c.Call(ctx, &result, "txpool_inspect"); err != nil {
 		return nil, err
 	}
-	if resp.Error != nil {
-		return nil, resp.Error
+	return result, nil
+}
+
+// TxPoolContent 交易池中的交易，按 pending/queued、地址、nonce 分组
+func (c *Client) TxPoolContent(ctx context.Context) (map[string]map[string]map[string]*StEthTransaction, error) {
+	var result map[string]map[string]map[string]*StEthTransaction
+	if err := c.Call(ctx, &result, "txpool_content"); err != nil {
+		return nil, err
 	}
-	return resp.Result, nil
+	return result, nil
 }
 
 // EthRpcSendRawTransaction 发送交易
-func (c *Client) EthRpcSendRawTransaction(rawTx string) (string, error) {
-	resp := struct {
-		StRpcResp
-		Result string `json:"result"`
-	}{}
-	err := c.doReq(
-		"eth_sendRawTransaction",
-		[]interface{}{
-			rawTx,
-		},
-		&resp,
-	)
-	if err != nil {
+func (c *Client) EthRpcSendRawTransaction(ctx context.Context, rawTx string) (string, error) {
+	var result string
+	if err := c.Call(ctx, &result, "eth_sendRawTransaction", rawTx); err != nil {
 		return "", err
 	}
-	if resp.Error != nil {
-		return "", resp.Error
-	}
-	return resp.Result, nil
+	return result, nil
 }
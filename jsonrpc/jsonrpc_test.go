@@ -0,0 +1,379 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoResult 把请求的 method 作为结果返回
+func echoResult(req StRpcReq) StRpcResp {
+	result, _ := json.Marshal(req.Method)
+	return StRpcResp{ID: req.ID, Result: result}
+}
+
+// newTestClient 连接到 handler，重试间隔缩短为 1ms
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewEthClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Backoff = time.Millisecond
+	return c
+}
+
+// failingHandler 前 fails 次请求返回 status，之后正常应答，hits 记录请求次数
+func failingHandler(status int, fails int32, hits *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(hits, 1) <= fails {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		var req StRpcReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(echoResult(req))
+	}
+}
+
+func TestCall(t *testing.T) {
+	var hits int32
+	c := newTestClient(t, failingHandler(http.StatusOK, 0, &hits))
+
+	var result string
+	if err := c.Call(context.Background(), &result, "net_version"); err != nil {
+		t.Fatal(err)
+	}
+	if result != "net_version" {
+		t.Errorf("result %q, want net_version", result)
+	}
+}
+
+func TestCallResponseID(t *testing.T) {
+	var body string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	// 属于其他请求的错误不能当作这个请求的错误
+	body = `{"jsonrpc":"2.0","id":12345,"error":{"code":-32000,"message":"nonce too low"}}`
+	err := c.Call(context.Background(), nil, "eth_sendRawTransaction", "0x00")
+	if err == nil || !strings.Contains(err.Error(), "does not match request id") {
+		t.Errorf("mismatched error response: %v", err)
+	}
+
+	body = `{"jsonrpc":"2.0","id":12345,"result":"0x1"}`
+	err = c.Call(context.Background(), nil, "net_version")
+	if err == nil || !strings.Contains(err.Error(), "does not match request id") {
+		t.Errorf("mismatched result: %v", err)
+	}
+
+	// 无法解析请求时 id 为 null
+	body = `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`
+	err = c.Call(context.Background(), nil, "net_version")
+	var rpcErr *StRpcRespError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32700 {
+		t.Errorf("null id error: %v", err)
+	}
+}
+
+func TestBatchCall(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var reqs []StRpcReq
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// 倒序应答，eth_chainId 出错，eth_gasPrice 没有应答，另外多一个未知 id 的应答
+		var resps []StRpcResp
+		for i := len(reqs) - 1; i >= 0; i-- {
+			switch reqs[i].Method {
+			case "eth_chainId":
+				resps = append(resps, StRpcResp{ID: reqs[i].ID, Error: &StRpcRespError{Code: -32601, Message: "method not found"}})
+			case "eth_gasPrice":
+			default:
+				resps = append(resps, echoResult(reqs[i]))
+			}
+		}
+		resps = append(resps, StRpcResp{ID: 12345, Result: json.RawMessage(`"stray"`)})
+		json.NewEncoder(w).Encode(resps)
+	})
+
+	results := make([]string, 4)
+	batch := []BatchElem{
+		{Method: "net_version", Result: &results[0]},
+		{Method: "eth_chainId", Result: &results[1]},
+		{Method: "eth_gasPrice", Result: &results[2]},
+		{Method: "eth_blockNumber", Result: &results[3]},
+	}
+	if err := c.BatchCall(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{0, 3} {
+		if batch[i].Error != nil || results[i] != batch[i].Method {
+			t.Errorf("%s: result %q, error %v", batch[i].Method, results[i], batch[i].Error)
+		}
+	}
+	var rpcErr *StRpcRespError
+	if !errors.As(batch[1].Error, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("eth_chainId: error %v, want the rpc error", batch[1].Error)
+	}
+	if batch[2].Error == nil || !strings.Contains(batch[2].Error.Error(), "no response in batch") {
+		t.Errorf("eth_gasPrice: error %v, want a missing response", batch[2].Error)
+	}
+}
+
+func TestBatchCallSingleError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch too large"}}`))
+	})
+
+	batch := []BatchElem{{Method: "net_version"}, {Method: "eth_chainId"}}
+	err := c.BatchCall(context.Background(), batch)
+	var rpcErr *StRpcRespError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32600 {
+		t.Errorf("error %v, want the batch error", err)
+	}
+}
+
+func TestCallRetry(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		var hits int32
+		c := newTestClient(t, failingHandler(status, 2, &hits))
+
+		var result string
+		if err := c.Call(context.Background(), &result, "net_version"); err != nil {
+			t.Errorf("http %d: %v", status, err)
+		}
+		if hits != 3 {
+			t.Errorf("http %d: %d requests, want 3", status, hits)
+		}
+	}
+
+	// 超过重试次数后返回最后一次的错误
+	var hits int32
+	c := newTestClient(t, failingHandler(http.StatusServiceUnavailable, 100, &hits))
+	err := c.Call(context.Background(), nil, "net_version")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("error %v, want http 503", err)
+	}
+	if want := int32(c.Retries + 1); hits != want {
+		t.Errorf("%d requests, want %d", hits, want)
+	}
+}
+
+func TestCallNoRetry(t *testing.T) {
+	// 客户端错误不重试
+	var hits int32
+	c := newTestClient(t, failingHandler(http.StatusBadRequest, 1, &hits))
+	if err := c.Call(context.Background(), nil, "net_version"); err == nil {
+		t.Error("http 400 did not fail")
+	}
+	if hits != 1 {
+		t.Errorf("http 400: %d requests, want 1", hits)
+	}
+
+	// 502 时节点可能已经广播了交易，发送交易不重试
+	for _, method := range []string{"eth_sendRawTransaction", "eth_sendTransaction"} {
+		hits = 0
+		c := newTestClient(t, failingHandler(http.StatusBadGateway, 1, &hits))
+		err := c.Call(context.Background(), nil, method, "0x00")
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+			t.Errorf("%s: error %v, want http 502", method, err)
+		}
+		if hits != 1 {
+			t.Errorf("%s: %d requests, want 1", method, hits)
+		}
+	}
+
+	// 429 表示请求没有被处理，可以重试
+	hits = 0
+	c = newTestClient(t, failingHandler(http.StatusTooManyRequests, 1, &hits))
+	if err := c.Call(context.Background(), nil, "eth_sendRawTransaction", "0x00"); err != nil {
+		t.Errorf("eth_sendRawTransaction after 429: %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("eth_sendRawTransaction after 429: %d requests, want 2", hits)
+	}
+
+	// 批量请求中有发送交易时同样不重试
+	hits = 0
+	c = newTestClient(t, failingHandler(http.StatusBadGateway, 1, &hits))
+	batch := []BatchElem{{Method: "net_version"}, {Method: "eth_sendRawTransaction", Params: []interface{}{"0x00"}}}
+	if err := c.BatchCall(context.Background(), batch); err == nil {
+		t.Error("batch with a send did not fail")
+	}
+	if hits != 1 {
+		t.Errorf("batch with a send: %d requests, want 1", hits)
+	}
+}
+
+func TestCallRetryCanceled(t *testing.T) {
+	var hits int32
+	c := newTestClient(t, failingHandler(http.StatusServiceUnavailable, 100, &hits))
+	c.Backoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, nil, "net_version"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the context deadline", err)
+	}
+	if hits != 1 {
+		t.Errorf("%d requests, want 1", hits)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for _, uri := range []string{"grpc://localhost:8545", "localhost:8545", filepath.Join(t.TempDir(), "geth.ipc")} {
+		if _, err := NewTransport(uri); err == nil {
+			t.Errorf("%s: no error", uri)
+		}
+	}
+	for _, uri := range []string{"http://localhost:8545", "https://localhost", "ws://localhost:8546", "wss://localhost"} {
+		if _, err := NewTransport(uri); err != nil {
+			t.Errorf("%s: %v", uri, err)
+		}
+	}
+}
+
+func TestWSTransport(t *testing.T) {
+	var conns int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt32(&conns, 1)
+		for {
+			var req StRpcReq
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			// close 请求让服务端断开连接
+			if req.Method == "close" {
+				return
+			}
+			if err := conn.WriteJSON(echoResult(req)); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewEthClient("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Backoff = time.Millisecond
+
+	for _, method := range []string{"net_version", "eth_chainId"} {
+		var result string
+		if err := c.Call(context.Background(), &result, method); err != nil {
+			t.Fatal(err)
+		}
+		if result != method {
+			t.Errorf("result %q, want %s", result, method)
+		}
+	}
+	if conns != 1 {
+		t.Errorf("%d connections, want the connection to be reused", conns)
+	}
+
+	// 连接断开后下一个请求重新连接
+	c.Retries = 0
+	if err := c.Call(context.Background(), nil, "close"); err == nil {
+		t.Error("closed connection did not fail")
+	}
+	var result string
+	if err := c.Call(context.Background(), &result, "net_version"); err != nil {
+		t.Fatal(err)
+	}
+	if conns != 2 {
+		t.Errorf("%d connections, want a reconnect", conns)
+	}
+}
+
+func TestIPCTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geth.ipc")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				dec, enc := json.NewDecoder(conn), json.NewEncoder(conn)
+				for {
+					var reqs []StRpcReq
+					var raw json.RawMessage
+					if err := dec.Decode(&raw); err != nil {
+						return
+					}
+					if err := json.Unmarshal(raw, &reqs); err != nil {
+						var req StRpcReq
+						json.Unmarshal(raw, &req)
+						enc.Encode(echoResult(req))
+						continue
+					}
+					resps := make([]StRpcResp, len(reqs))
+					for i, req := range reqs {
+						resps[i] = echoResult(req)
+					}
+					enc.Encode(resps)
+				}
+			}()
+		}
+	}()
+
+	c, err := NewEthClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var result string
+	if err := c.Call(context.Background(), &result, "net_version"); err != nil {
+		t.Fatal(err)
+	}
+	if result != "net_version" {
+		t.Errorf("result %q, want net_version", result)
+	}
+
+	results := make([]string, 2)
+	batch := []BatchElem{{Method: "eth_chainId", Result: &results[0]}, {Method: "eth_gasPrice", Result: &results[1]}}
+	if err := c.BatchCall(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if elem.Error != nil || results[i] != elem.Method {
+			t.Errorf("%s: result %q, error %v", elem.Method, results[i], elem.Error)
+		}
+	}
+}
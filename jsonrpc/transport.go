@@ -0,0 +1,241 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport 发送一个 JSON-RPC 请求体（单个请求或批量数组）并返回原始的响应体。
+// 实现需要可以被多个 goroutine 同时使用。
+type Transport interface {
+	RoundTrip(ctx context.Context, payload []byte) ([]byte, error)
+	Close() error
+}
+
+// HTTPError 节点返回了非 200 的 HTTP 状态码
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary 429 和 5xx 可以重试
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// NewTransport 根据地址选择传输方式：http(s)://、ws(s):// 或 IPC 文件路径。
+// 其他协议（如 grpc://）和不存在的路径（如漏写了 http:// 的 localhost:8545）返回错误，而不是当作 IPC 连接。
+func NewTransport(rawURI string) (Transport, error) {
+	switch {
+	case strings.HasPrefix(rawURI, "http://"), strings.HasPrefix(rawURI, "https://"):
+		return NewHTTPTransport(rawURI, 5*time.Minute), nil
+	case strings.HasPrefix(rawURI, "ws://"), strings.HasPrefix(rawURI, "wss://"):
+		return NewWSTransport(rawURI), nil
+	case strings.Contains(rawURI, "://"):
+		return nil, fmt.Errorf("unsupported scheme in endpoint %s, expected http(s)://, ws(s):// or an IPC path", rawURI)
+	}
+	if _, err := os.Stat(rawURI); err != nil {
+		return nil, fmt.Errorf("unsupported endpoint %q, expected http(s)://, ws(s):// or an IPC path: %w", rawURI, err)
+	}
+	return NewIPCTransport(rawURI), nil
+}
+
+// HTTPTransport 通过 HTTP POST 发送请求
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPTransport(url string, timeout time.Duration) *HTTPTransport {
+	return &HTTPTransport{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (t *HTTPTransport) RoundTrip(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// streamTransport 在一条长连接上依次发送请求，WebSocket 和 IPC 共用。
+// 连接在第一次使用时建立，出错后丢弃，下一次请求重新连接。
+type streamTransport struct {
+	mu   sync.Mutex
+	dial func(ctx context.Context) (streamConn, error)
+	conn streamConn
+}
+
+type streamConn interface {
+	write(payload []byte) error
+	read() ([]byte, error)
+	setDeadline(t time.Time) error
+	close() error
+}
+
+func (t *streamTransport) RoundTrip(ctx context.Context, payload []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := t.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		t.conn = conn
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Minute)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func(conn streamConn) {
+		select {
+		case <-ctx.Done():
+			conn.setDeadline(time.Now())
+		case <-stop:
+		}
+	}(t.conn)
+
+	body, err := t.exchange(deadline, payload)
+	if err != nil {
+		t.conn.close()
+		t.conn = nil
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+func (t *streamTransport) exchange(deadline time.Time, payload []byte) ([]byte, error) {
+	if err := t.conn.setDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := t.conn.write(payload); err != nil {
+		return nil, err
+	}
+	return t.conn.read()
+}
+
+func (t *streamTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.close()
+	t.conn = nil
+	return err
+}
+
+// NewWSTransport 通过 WebSocket 发送请求
+func NewWSTransport(url string) Transport {
+	return &streamTransport{dial: func(ctx context.Context) (streamConn, error) {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &wsConn{conn}, nil
+	}}
+}
+
+type wsConn struct {
+	c *websocket.Conn
+}
+
+func (c *wsConn) write(payload []byte) error {
+	return c.c.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (c *wsConn) read() ([]byte, error) {
+	_, body, err := c.c.ReadMessage()
+	return body, err
+}
+
+func (c *wsConn) setDeadline(t time.Time) error {
+	if err := c.c.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.c.SetReadDeadline(t)
+}
+
+func (c *wsConn) close() error {
+	return c.c.Close()
+}
+
+// NewIPCTransport 通过 unix socket（geth.ipc）发送请求
+func NewIPCTransport(path string) Transport {
+	return &streamTransport{dial: func(ctx context.Context) (streamConn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return nil, err
+		}
+		return &ipcConn{conn: conn, dec: json.NewDecoder(conn)}, nil
+	}}
+}
+
+type ipcConn struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+func (c *ipcConn) write(payload []byte) error {
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+func (c *ipcConn) read() ([]byte, error) {
+	var body json.RawMessage
+	err := c.dec.Decode(&body)
+	return body, err
+}
+
+func (c *ipcConn) setDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *ipcConn) close() error {
+	return c.conn.Close()
+}
@@ -2,68 +2,76 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"geth-cli/jsonrpc"
+	"geth-cli/payments"
 	"log"
 	"math/big"
 	"os"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 )
 
-var defaultEndPoint = "http://120.79.149.59:8545"
+const goerliEndPoint = "http://120.79.149.59:8545"
+
+// defaultEndPoint 当前网络的节点地址，由 setupNetwork 根据配置和 ENDPOINT 环境变量设置。
+var defaultEndPoint = goerliEndPoint
 
 var client *jsonrpc.Client
 
 func main() {
-	endpoint := os.Getenv("ENDPOINT")
-	if endpoint != "" {
-		defaultEndPoint = endpoint
-	}
-
-	client = jsonrpc.NewEthClient(defaultEndPoint)
-
 	local := []*cli.Command{
 		txPoolCmd,
 		gasPriceCmd,
 		ETHCmd,
 		BZZCmd,
+		TokenCmd,
+		TxCmd,
+		accountCmd,
+		configCmd,
+		balanceCmd,
+		NonceCmd,
+		sweepCmd,
 	}
 
 	app := &cli.App{
 		Name:     "geth-cli",
 		Usage:    "Common Ethereum tools",
 		Commands: local,
+		Flags:    append(configFlags, dryRunFlag, outputFlag),
+		Before:   setupNetwork,
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Println(err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 var gasPriceCmd = &cli.Command{
-	Name:  "gas-price",
-	Usage: "return the current gas price (Gwei)",
+	Name:   "gas-price",
+	Usage:  "return the current gas price (Gwei)",
+	Before: connectNode,
 	Action: func(c *cli.Context) error {
 		client, err := ethclient.Dial(defaultEndPoint)
 		if err != nil {
 			return err
 		}
+		defer client.Close()
 
 		gasPrice, err := client.SuggestGasPrice(context.Background())
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("currnet gasPrice: %v Gwei\n", float64(gasPrice.Int64())/1000000000)
-		return nil
+		result := map[string]string{"gasPrice": gasPrice.String(), "gasPriceGwei": formatDecimal(gasPrice, 9)}
+		return printResult(result, func() {
+			fmt.Printf("current gasPrice: %s Gwei\n", formatDecimal(gasPrice, 9))
+		})
 	},
 }
 
@@ -78,129 +86,95 @@ var ethBalancesCmd = &cli.Command{
 		},
 	},
 	Action: func(c *cli.Context) error {
+		account, err := addressFlag(c, "address")
+		if err != nil {
+			return err
+		}
 		client, err := ethclient.Dial(defaultEndPoint)
 		if err != nil {
 			return err
 		}
-		account := common.HexToAddress(c.String("address"))
 		balance, err := client.BalanceAt(context.Background(), account, nil)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		fmt.Println(balance)
-		return nil
+		return printResult(newAmountResult(account, nil, balance), func() {
+			fmt.Println(balance)
+		})
 	},
 }
 
 var sendEthCmd = &cli.Command{
 	Name: "send",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:     "fromKey",
-			Value:    "",
-			Required: true,
-			Usage:    "specify the private key of the send wallet",
-		},
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "toKey",
 			Value:    "",
 			Required: true,
 			Usage:    "the public key of the receive wallet",
 		},
-		&cli.Int64Flag{
+		&cli.StringFlag{
 			Name:     "amount",
-			Value:    1000,
+			Value:    "",
 			Required: true,
-			Usage:    "the amount of token (0.00001 eth)",
+			Usage:    "the amount with a unit: eth, gwei or wei (e.g. 1.5eth, 2gwei, 300wei)",
 		},
 		&cli.Uint64Flag{
 			Name:  "gasLimit",
 			Value: 21000, // in units
 			Usage: "the amount of gas limit (wei)",
 		},
-		&cli.Uint64Flag{
-			Name:  "nGasPrice",
-			Value: 2, // in units
-			Usage: "n times of the current gas price",
-		},
-	},
+	}, append(append(feeFlags, waitFlags...), keyFlags...)...),
 	Action: func(c *cli.Context) error {
-		return PayEth(defaultEndPoint, c.String("fromKey"), c.String("toKey"), c.Int64("amount"), c.Uint64("gasLimit"), c.Uint64("nGasPrice"))
+		amount, err := parseAmount(c.String("amount"), ethUnits, "")
+		if err != nil {
+			return err
+		}
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		signedTx, err := PayEth(defaultEndPoint, signer, c.String("toKey"), amount, c.Uint64("gasLimit"), feeOpts)
+		if err != nil {
+			return err
+		}
+		return waitIfRequested(c, signedTx)
 	},
 }
 
 var ETHCmd = &cli.Command{
-	Name: "eth",
+	Name:   "eth",
+	Before: connectNode,
 	Subcommands:[]*cli.Command{
 		ethBalancesCmd,
 		sendEthCmd,
+		batchEthCmd,
 	},
 }
 
-// PayEth 传入出账的私钥（geth导入账号那部分），传入要进账的公钥，金额单位是wei * 10的9次方。
-func PayEth(endpoint, fromKey, toKey string, amount int64, gasLimit, nGasPrice uint64) error {
-	if toKey == "" {
-		return xerrors.New("receiver must not be empty")
+// PayEth 传入签名账户（见 loadSigner），传入要进账的公钥，金额单位是wei，返回已发送的交易。
+func PayEth(endpoint string, signer payments.Signer, toKey string, amount *big.Int, gasLimit uint64, feeOpts payments.FeeOptions) (*types.Transaction, error) {
+	if !common.IsHexAddress(toKey) {
+		return nil, xerrors.Errorf("invalid receiver address: %q", toKey)
 	}
 
-	client, err := ethclient.Dial(endpoint)
+	ctx := context.Background()
+	sender, err := newSender(ctx, endpoint, signer, feeOpts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 出账的私钥。
-	privateKey, err := crypto.HexToECDSA(fromKey)
+	result, err := sender.SendETH(ctx, common.HexToAddress(toKey), amount, gasLimit)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 出账的公钥
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		log.Println("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
-		return err
-	}
-
-	// 进账的地址。
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-	if err != nil {
-		return err
-	}
-
-	// 支付的金额。
-	value := big.NewInt(amount * 100000000000000) // in wei (0.000000001 eth)
-	price, err := client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return err
-	}
-
-	gasPrice := big.NewInt(0).Mul(price, big.NewInt(int64(nGasPrice)))
-
-	log.Println("gas Price:", gasPrice)
-	log.Println("gas Limit:", gasLimit)
-
-	toAddress := common.HexToAddress(toKey)
-	tx := types.NewTransaction(nonce, toAddress, value, gasLimit, gasPrice, nil)
-
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		return err
-	}
-
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
-	if err != nil {
-		return err
-	}
-
-	err = client.SendTransaction(context.Background(), signedTx)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("eth tx sent: %s", signedTx.Hash().Hex())
-
-	return nil
+	logBuilt(result)
+	logTxSent("eth", result.Tx)
+	return result.Tx, nil
 }
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// nonceLockTimeout 等待其他进程释放 nonce 日志锁的最长时间。
+	nonceLockTimeout = 30 * time.Second
+	// nonceLockStale 超过这个时间的锁文件认为是崩溃的进程留下的。
+	nonceLockStale = 2 * time.Minute
+	// nonceReservationTTL 已分配但一直没有记录交易哈希的 nonce 在这个时间后可以重新分配，tx build 的预留除外。
+	nonceReservationTTL = 10 * time.Minute
+)
+
+// errNonceNotUsed 预留的 nonce 没有使用，传给 NonceReservation.Done 释放 nonce。
+var errNonceNotUsed = xerrors.New("nonce not used")
+
+// NonceCmd 查看和维护本地的 nonce 日志。
+var NonceCmd = &cli.Command{
+	Name:   "nonce",
+	Usage:  "show and repair the local nonce journal shared by concurrent senders",
+	Before: connectNode,
+	Subcommands: []*cli.Command{
+		nonceShowCmd,
+		nonceResetCmd,
+		nonceFillGapsCmd,
+	},
+}
+
+var nonceAddressFlag = &cli.StringFlag{
+	Name:  "address",
+	Value: "",
+	Usage: "the account address (default the address of the signing key)",
+}
+
+var nonceShowCmd = &cli.Command{
+	Name:  "show",
+	Usage: "compare the journal with the node's latest and pending nonces and list the gaps",
+	Flags: append([]cli.Flag{nonceAddressFlag}, keyFlags...),
+	Action: func(c *cli.Context) error {
+		etchClient, m, err := nonceManagerFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		state, err := m.State(context.Background(), etchClient)
+		if err != nil {
+			return err
+		}
+
+		return printResult(state, func() {
+			fmt.Printf("address:        %s\n", state.Address.Hex())
+			fmt.Printf("chain id:       %d\n", state.ChainID)
+			fmt.Printf("journal:        %s\n", state.Journal)
+			fmt.Printf("latest nonce:   %d\n", state.Latest)
+			fmt.Printf("pending nonce:  %d\n", state.Pending)
+			fmt.Printf("next nonce:     %d\n", state.Next)
+			for _, issued := range state.Issued {
+				hash := "(reserved)"
+				switch {
+				case issued.Hash != nil:
+					hash = issued.Hash.Hex()
+				case issued.Offline:
+					hash = "(tx build)"
+				}
+				fmt.Printf("  nonce %d\t%s\t%s\t%s\n", issued.Nonce, hash, issued.Status, issued.Time.Format(time.RFC3339))
+			}
+			if len(state.Gaps) > 0 {
+				fmt.Printf("gaps:           %s\n", formatNonces(state.Gaps))
+			}
+		})
+	},
+}
+
+var nonceResetCmd = &cli.Command{
+	Name:  "reset",
+	Usage: "forget all issued nonces, the next send starts from the node's pending nonce",
+	Flags: append([]cli.Flag{nonceAddressFlag}, keyFlags...),
+	Action: func(c *cli.Context) error {
+		_, m, err := nonceManagerFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		if err := m.Reset(); err != nil {
+			return err
+		}
+		log.Printf("nonce journal %s cleared", m.path)
+		return printResult(map[string]interface{}{"address": m.address, "chainId": m.chainID.Uint64(), "reset": true}, nil)
+	},
+}
+
+var nonceFillGapsCmd = &cli.Command{
+	Name:  "fill-gaps",
+	Usage: "send 0-value transfers to self for journal nonces the node has lost, so later transactions can be mined",
+	Flags: append(append([]cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "gasLimit",
+			Value: 21000,
+			Usage: "the gas limit of the self transfers",
+		},
+	}, feeFlags...), keyFlags...),
+	Action: func(c *cli.Context) error {
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+
+		etchClient, m, err := openNonceManager(signer.Address())
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		state, err := m.State(ctx, etchClient)
+		if err != nil {
+			return err
+		}
+		if len(state.Gaps) == 0 {
+			log.Println("no nonce gaps")
+			return printReplaceResults(nil, false)
+		}
+
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		sender, err := newSender(ctx, defaultEndPoint, signer, feeOpts)
+		if err != nil {
+			return err
+		}
+
+		var results []*ReplaceResult
+		for _, nonce := range state.Gaps {
+			result, err := sender.Cancel(ctx, nonce, nil, payments.ReplaceOptions{GasLimit: c.Uint64("gasLimit")})
+			results = append(results, newReplaceResult("fill", nonce, result, err))
+		}
+		return printReplaceResults(results, true)
+	},
+}
+
+// nonceManagerFromContext 连接节点并按 --address 或签名账户打开 nonce 日志。
+func nonceManagerFromContext(c *cli.Context) (*ethclient.Client, *NonceManager, error) {
+	if a := c.String("address"); a != "" {
+		if !common.IsHexAddress(a) {
+			return nil, nil, xerrors.Errorf("invalid address: %s", a)
+		}
+		return openNonceManager(common.HexToAddress(a))
+	}
+
+	signer, err := loadSigner(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openNonceManager(signer.Address())
+}
+
+// openNonceManager 连接节点，按节点的 chain id 打开 address 的 nonce 日志。
+func openNonceManager(address common.Address) (*ethclient.Client, *NonceManager, error) {
+	etchClient, err := ethclient.Dial(defaultEndPoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	chainID, err := signingChainID(context.Background(), etchClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	return etchClient, newNonceManager(chainID, address), nil
+}
+
+// NonceManager 管理一个账户在一条链上已经分配的 nonce。
+// 日志保存在 ~/.config/geth-cli/nonces/<chain id>/<address>.json，多个进程通过锁文件互斥访问，
+// 同一账户的并发发送不会拿到相同的 nonce。
+type NonceManager struct {
+	address common.Address
+	chainID *big.Int
+	path    string
+}
+
+// IssuedNonce 日志中的一个 nonce，Hash 为空表示已分配但还没有发送。
+// Offline 表示 tx build 预留的 nonce，离线签名的时间不确定，预留不会过期，
+// 直到 tx broadcast 记录交易哈希或释放它，也可以用 nonce reset 清除。
+type IssuedNonce struct {
+	Nonce   uint64       `json:"nonce"`
+	Hash    *common.Hash `json:"hash,omitempty"`
+	Offline bool         `json:"offline,omitempty"`
+	Time    time.Time    `json:"time"`
+	Status  string       `json:"status,omitempty"`
+}
+
+type nonceJournal struct {
+	Address common.Address `json:"address"`
+	ChainID uint64         `json:"chainId"`
+	Issued  []*IssuedNonce `json:"issued"`
+}
+
+// NonceState nonce show 的结果。
+type NonceState struct {
+	Address common.Address `json:"address"`
+	ChainID uint64         `json:"chainId"`
+	Journal string         `json:"journal"`
+	Latest  uint64         `json:"latest"`
+	Pending uint64         `json:"pending"`
+	Next    uint64         `json:"next"`
+	Issued  []*IssuedNonce `json:"issued"`
+	Gaps    []uint64       `json:"gaps"`
+}
+
+// nonceBackend 分配 nonce 时需要的节点接口。
+type nonceBackend interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// nonceStateBackend 检查日志时还需要按哈希查找交易。
+type nonceStateBackend interface {
+	nonceBackend
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+}
+
+// NonceReservation 一个已经分配、还没有记录发送结果的 nonce。
+type NonceReservation struct {
+	m     *NonceManager
+	Nonce uint64
+}
+
+func newNonceManager(chainID *big.Int, address common.Address) *NonceManager {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	path := filepath.Join(dir, "geth-cli", "nonces", chainID.String(), strings.ToLower(address.Hex())+".json")
+	return &NonceManager{address: address, chainID: chainID, path: path}
+}
+
+// Reserve 分配下一个可用的 nonce，见 ReserveAtLeast。
+func (m *NonceManager) Reserve(ctx context.Context, client nonceBackend) (*NonceReservation, error) {
+	return m.ReserveAtLeast(ctx, client, 0)
+}
+
+// ReserveAtLeast 分配不小于 min 的 nonce：从节点的 pending nonce 开始，跳过日志中其他发送者已经占用的 nonce。
+// 已经上链的记录会从日志中删除。
+func (m *NonceManager) ReserveAtLeast(ctx context.Context, client nonceBackend, min uint64) (*NonceReservation, error) {
+	return m.reserve(ctx, client, min, false)
+}
+
+// reserve 实现 ReserveAtLeast，offline 为 true 时是 tx build 的预留，见 IssuedNonce。
+func (m *NonceManager) reserve(ctx context.Context, client nonceBackend, min uint64, offline bool) (*NonceReservation, error) {
+	latest, err := client.NonceAt(ctx, m.address, nil)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := client.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce uint64
+	err = m.update(func(j *nonceJournal) error {
+		j.prune(latest)
+
+		nonce = j.next(pending, min)
+		j.Issued = append(j.Issued, &IssuedNonce{Nonce: nonce, Offline: offline, Time: time.Now()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &NonceReservation{m: m, Nonce: nonce}, nil
+}
+
+// Peek 返回 ReserveAtLeast 会分配的 nonce，但不写入日志，用于 --dry-run。
+func (m *NonceManager) Peek(ctx context.Context, client nonceBackend, min uint64) (uint64, error) {
+	latest, err := client.NonceAt(ctx, m.address, nil)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := client.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		return 0, err
+	}
+
+	j, err := m.read()
+	if err != nil {
+		return 0, err
+	}
+	j.prune(latest)
+	return j.next(pending, min), nil
+}
+
+// Done 记录发送结果：发送成功时保存交易哈希，发送失败或 --dry-run 时释放 nonce。
+func (r *NonceReservation) Done(hash common.Hash, sendErr error) {
+	var err error
+	if sendErr != nil || dryRun {
+		err = r.m.Release(r.Nonce)
+	} else {
+		err = r.m.Record(r.Nonce, hash)
+	}
+	if err != nil {
+		log.Printf("nonce journal: %s", err.Error())
+	}
+}
+
+// Record 记录 nonce 对应的交易哈希，替换交易时覆盖原来的哈希。
+func (m *NonceManager) Record(nonce uint64, hash common.Hash) error {
+	return m.update(func(j *nonceJournal) error {
+		for _, issued := range j.Issued {
+			if issued.Nonce == nonce {
+				issued.Hash, issued.Offline, issued.Time = &hash, false, time.Now()
+				return nil
+			}
+		}
+		j.Issued = append(j.Issued, &IssuedNonce{Nonce: nonce, Hash: &hash, Time: time.Now()})
+		return nil
+	})
+}
+
+// Release 释放一个没有发送出去的 nonce。
+func (m *NonceManager) Release(nonce uint64) error {
+	return m.update(func(j *nonceJournal) error {
+		kept := j.Issued[:0]
+		for _, issued := range j.Issued {
+			if issued.Nonce != nonce || issued.Hash != nil {
+				kept = append(kept, issued)
+			}
+		}
+		j.Issued = kept
+		return nil
+	})
+}
+
+// Reset 删除日志。
+func (m *NonceManager) Reset() error {
+	unlock, err := lockFile(m.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(m.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// State 对照节点检查日志：日志中已发送但节点里找不到、也没有上链的 nonce 是空缺，
+// 空缺之后的交易都无法上链。
+func (m *NonceManager) State(ctx context.Context, client nonceStateBackend) (*NonceState, error) {
+	latest, err := client.NonceAt(ctx, m.address, nil)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := client.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		return nil, err
+	}
+
+	var j *nonceJournal
+	err = m.update(func(journal *nonceJournal) error {
+		journal.prune(latest)
+		j = journal
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &NonceState{
+		Address: m.address,
+		ChainID: m.chainID.Uint64(),
+		Journal: m.path,
+		Latest:  latest,
+		Pending: pending,
+		Next:    pending,
+		Issued:  j.Issued,
+		Gaps:    []uint64{},
+	}
+
+	known := make(map[uint64]bool)
+	for n := latest; n < pending; n++ {
+		known[n] = true
+	}
+
+	var top uint64
+	for _, issued := range j.Issued {
+		if issued.Nonce+1 > top {
+			top = issued.Nonce + 1
+		}
+		switch {
+		case issued.Hash == nil && issued.Offline:
+			issued.Status = "built"
+			known[issued.Nonce] = true
+		case issued.Hash == nil:
+			issued.Status = "reserved"
+			known[issued.Nonce] = true
+		case known[issued.Nonce]:
+			issued.Status = "pending"
+		default:
+			if _, _, err := client.TransactionByHash(ctx, *issued.Hash); err == nil {
+				issued.Status = "queued"
+				known[issued.Nonce] = true
+			} else if xerrors.Is(err, ethereum.NotFound) {
+				issued.Status = "missing"
+			} else {
+				return nil, err
+			}
+		}
+	}
+	if top > state.Next {
+		state.Next = top
+	}
+
+	for n := latest; n < top; n++ {
+		if !known[n] {
+			state.Gaps = append(state.Gaps, n)
+		}
+	}
+	return state, nil
+}
+
+// update 在持有锁的情况下读取、修改并保存日志。
+func (m *NonceManager) update(fn func(j *nonceJournal) error) error {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(m.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	j, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(j); err != nil {
+		return err
+	}
+
+	sort.Slice(j.Issued, func(a, b int) bool { return j.Issued[a].Nonce < j.Issued[b].Nonce })
+	out, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// read 读取日志，文件不存在时返回空的日志。保存时先写临时文件再改名，不加锁读取也不会读到写了一半的文件。
+func (m *NonceManager) read() (*nonceJournal, error) {
+	j := &nonceJournal{Address: m.address, ChainID: m.chainID.Uint64()}
+	data, err := ioutil.ReadFile(m.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, j); err != nil {
+			return nil, xerrors.Errorf("%s: %w", m.path, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	return j, nil
+}
+
+// prune 删除已经上链的 nonce 和过期的预留，tx build 的预留不会过期。
+func (j *nonceJournal) prune(latest uint64) {
+	kept := j.Issued[:0]
+	for _, issued := range j.Issued {
+		if issued.Nonce < latest {
+			continue
+		}
+		if issued.Hash == nil && !issued.Offline && time.Since(issued.Time) > nonceReservationTTL {
+			continue
+		}
+		kept = append(kept, issued)
+	}
+	j.Issued = kept
+}
+
+// next 返回从 pending 和 min 中较大的一个开始、日志中没有占用的第一个 nonce。
+func (j *nonceJournal) next(pending, min uint64) uint64 {
+	taken := make(map[uint64]bool, len(j.Issued))
+	for _, issued := range j.Issued {
+		taken[issued.Nonce] = true
+	}
+
+	nonce := pending
+	if min > nonce {
+		nonce = min
+	}
+	for taken[nonce] {
+		nonce++
+	}
+	return nonce
+}
+
+// lockFile 创建锁文件实现进程间互斥，返回释放锁的函数。崩溃的进程留下的过期锁文件会被删除。
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(nonceLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > nonceLockStale {
+			log.Printf("removing stale lock %s", path)
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, xerrors.Errorf("%s is held by another process, remove it if no geth-cli is running", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func formatNonces(nonces []uint64) string {
+	var parts []string
+	for _, n := range nonces {
+		parts = append(parts, strconv.FormatUint(n, 10))
+	}
+	return strings.Join(parts, ", ")
+}
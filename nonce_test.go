@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeNonceBackend 固定的 latest 和 pending nonce，txs 中的交易在交易池里。
+type fakeNonceBackend struct {
+	latest, pending uint64
+	txs             map[common.Hash]bool
+}
+
+func (b *fakeNonceBackend) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return b.latest, nil
+}
+
+func (b *fakeNonceBackend) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	return b.pending, nil
+}
+
+func (b *fakeNonceBackend) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	if b.txs[hash] {
+		return types.NewTx(&types.LegacyTx{}), true, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+// newTestNonceManager 在临时的配置目录中打开 nonce 日志。
+func newTestNonceManager(t *testing.T) *NonceManager {
+	old, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", old)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	})
+	return newNonceManager(big.NewInt(1337), common.HexToAddress("0x5A72773ab050d00e9Ece7D7B9533638B2e57926B"))
+}
+
+func journalNoncesOf(t *testing.T, m *NonceManager) []uint64 {
+	j, err := m.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonces := []uint64{}
+	for _, issued := range j.Issued {
+		nonces = append(nonces, issued.Nonce)
+	}
+	return nonces
+}
+
+func TestNonceReserve(t *testing.T) {
+	m := newTestNonceManager(t)
+	backend := &fakeNonceBackend{latest: 5, pending: 5}
+	ctx := context.Background()
+
+	reserve := func(min uint64) uint64 {
+		r, err := m.ReserveAtLeast(ctx, backend, min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Nonce
+	}
+
+	if n := reserve(0); n != 5 {
+		t.Fatalf("first reservation %d, want the pending nonce 5", n)
+	}
+	if n := reserve(0); n != 6 {
+		t.Fatalf("second reservation %d, want 6", n)
+	}
+	if n := reserve(10); n != 10 {
+		t.Fatalf("reservation of at least 10: %d", n)
+	}
+
+	if err := m.Release(6); err != nil {
+		t.Fatal(err)
+	}
+	if n := reserve(0); n != 6 {
+		t.Fatalf("reservation after releasing 6: %d, want 6", n)
+	}
+
+	// 记录了交易哈希的 nonce 不会被释放
+	if err := m.Record(5, common.Hash{5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Release(5); err != nil {
+		t.Fatal(err)
+	}
+	if got := journalNoncesOf(t, m); !reflect.DeepEqual(got, []uint64{5, 6, 10}) {
+		t.Errorf("journal %v, want [5 6 10]", got)
+	}
+
+	if err := m.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if n := reserve(0); n != 5 {
+		t.Errorf("reservation after reset %d, want 5", n)
+	}
+}
+
+func TestNonceReserveConcurrent(t *testing.T) {
+	m := newTestNonceManager(t)
+	backend := &fakeNonceBackend{}
+
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := m.Reserve(context.Background(), backend)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[r.Nonce] {
+				t.Errorf("nonce %d reserved twice", r.Nonce)
+			}
+			seen[r.Nonce] = true
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNoncePrune(t *testing.T) {
+	m := newTestNonceManager(t)
+	expired := time.Now().Add(-nonceReservationTTL - time.Minute)
+	err := m.update(func(j *nonceJournal) error {
+		j.Issued = []*IssuedNonce{
+			{Nonce: 1, Hash: &common.Hash{1}, Time: time.Now()},
+			{Nonce: 2, Time: time.Now()},
+			{Nonce: 3, Time: expired},
+			{Nonce: 4, Offline: true, Time: expired},
+			{Nonce: 5, Hash: &common.Hash{5}, Time: expired},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// latest 为 2：nonce 1 已上链，nonce 3 的预留过期，tx build 的预留和已发送的交易保留
+	r, err := m.Reserve(context.Background(), &fakeNonceBackend{latest: 2, pending: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Nonce != 3 {
+		t.Errorf("reserved %d, want the expired nonce 3", r.Nonce)
+	}
+	if got := journalNoncesOf(t, m); !reflect.DeepEqual(got, []uint64{2, 3, 4, 5}) {
+		t.Errorf("journal %v, want [2 3 4 5]", got)
+	}
+}
+
+func TestNonceStateGaps(t *testing.T) {
+	m := newTestNonceManager(t)
+	err := m.update(func(j *nonceJournal) error {
+		j.Issued = []*IssuedNonce{
+			{Nonce: 3, Hash: &common.Hash{3}, Time: time.Now()},
+			{Nonce: 4, Hash: &common.Hash{4}, Time: time.Now()},
+			{Nonce: 5, Hash: &common.Hash{5}, Time: time.Now()},
+			{Nonce: 7, Offline: true, Time: time.Now()},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nonce 3 在 pending 中，nonce 4 在 queued 中，nonce 5 节点已经丢失，nonce 6 从未发送
+	backend := &fakeNonceBackend{latest: 3, pending: 4, txs: map[common.Hash]bool{{4}: true}}
+	state, err := m.State(context.Background(), backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	for _, issued := range state.Issued {
+		statuses = append(statuses, issued.Status)
+	}
+	if want := []string{"pending", "queued", "missing", "built"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses %v, want %v", statuses, want)
+	}
+	if !reflect.DeepEqual(state.Gaps, []uint64{5, 6}) {
+		t.Errorf("gaps %v, want [5 6]", state.Gaps)
+	}
+	if state.Next != 8 {
+		t.Errorf("next nonce %d, want 8", state.Next)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.lock")
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := lockFile(path)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the lock was taken twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock was not taken after it was released")
+	}
+
+	// 崩溃的进程留下的锁文件
+	if err := ioutil.WriteFile(path, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-nonceLockStale - time.Minute)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockFile(path)
+	if err != nil {
+		t.Fatalf("stale lock: %v", err)
+	}
+	unlock()
+}
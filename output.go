@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// outputFormat 全局参数 --output。json 和 yaml 时每个命令只在 stdout 输出一个结果对象，
+// 给人看的信息和日志都输出到 stderr。
+var outputFormat = "text"
+
+var outputFlag = &cli.StringFlag{
+	Name:  "output",
+	Value: "text",
+	Usage: "text, json or yaml; json and yaml print one result object on stdout and everything else on stderr",
+}
+
+func setOutputFormat(format string) error {
+	switch format {
+	case "text", "json", "yaml":
+		outputFormat = format
+		return nil
+	}
+	return xerrors.Errorf("unknown output format %q, expected text, json or yaml", format)
+}
+
+// textOut 给人看的输出的目标，json 和 yaml 时为 stderr，保证 stdout 只有结果对象。
+func textOut() io.Writer {
+	if outputFormat == "text" {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// printResult 输出命令的结果对象，text 时调用 text 按原来的格式输出。
+// yaml 由 json 转换而来，字段名和数值格式与 json 相同。
+func printResult(result interface{}, text func()) error {
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case "yaml":
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	if text != nil {
+		text()
+	}
+	return nil
+}
+
+// TxResult 发送交易的命令输出的结果，金额单位为 wei。
+type TxResult struct {
+	Hash     common.Hash     `json:"hash"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Nonce    uint64          `json:"nonce"`
+	ChainID  string          `json:"chainId"`
+	Value    string          `json:"value"`
+	GasLimit uint64          `json:"gasLimit"`
+	DryRun   bool            `json:"dryRun,omitempty"`
+	Raw      string          `json:"raw,omitempty"`
+	Receipt  *ReceiptResult  `json:"receipt,omitempty"`
+}
+
+// ReceiptResult 交易回执的摘要。
+type ReceiptResult struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	Status      uint64 `json:"status"`
+	GasUsed     uint64 `json:"gasUsed"`
+}
+
+func newTxResult(tx *types.Transaction, receipt *types.Receipt) *TxResult {
+	result := &TxResult{
+		Hash:     tx.Hash(),
+		To:       tx.To(),
+		Nonce:    tx.Nonce(),
+		ChainID:  tx.ChainId().String(),
+		Value:    tx.Value().String(),
+		GasLimit: tx.Gas(),
+		DryRun:   dryRun,
+	}
+	if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		result.From = from
+	}
+	if dryRun {
+		if raw, err := tx.MarshalBinary(); err == nil {
+			result.Raw = hexutil.Encode(raw)
+		}
+	}
+	if receipt != nil {
+		result.Receipt = newReceiptResult(receipt)
+	}
+	return result
+}
+
+func newReceiptResult(receipt *types.Receipt) *ReceiptResult {
+	return &ReceiptResult{
+		BlockNumber: receipt.BlockNumber.Uint64(),
+		Status:      receipt.Status,
+		GasUsed:     receipt.GasUsed,
+	}
+}
+
+// AmountResult 余额等金额类的结果，Amount 为按单位格式化的金额，Raw 为最小单位的整数。
+type AmountResult struct {
+	Address common.Address  `json:"address"`
+	Token   *common.Address `json:"token,omitempty"`
+	Symbol  string          `json:"symbol"`
+	Amount  string          `json:"amount"`
+	Raw     string          `json:"raw"`
+}
+
+// decimalString 最小单位的整数输出为十进制字符串，json 中的大整数会被 jq 等工具当作浮点数丢失精度。
+func decimalString(x *big.Int) string {
+	if x == nil {
+		return ""
+	}
+	return x.String()
+}
+
+func newAmountResult(address common.Address, info *TokenInfo, raw *big.Int) *AmountResult {
+	if info == nil {
+		return &AmountResult{Address: address, Symbol: "ETH", Amount: formatDecimal(raw, 18), Raw: raw.String()}
+	}
+	token := info.Address
+	return &AmountResult{Address: address, Token: &token, Symbol: info.Symbol, Amount: formatDecimal(raw, info.Decimals), Raw: raw.String()}
+}
@@ -0,0 +1,132 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+
+	"geth-cli/jsonrpc"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/xerrors"
+)
+
+// ClefSigner 把未签名的交易通过 account_signTransaction 交给外部签名服务（clef）签名，
+// 私钥不进入本进程，每笔交易在签名服务中批准。
+type ClefSigner struct {
+	rpc     *jsonrpc.Client
+	address common.Address
+}
+
+// NewClefSigner 连接签名服务，endpoint 可以是 IPC 文件路径或 http(s):// 地址。
+// address 为空时使用签名服务中唯一的账户。
+func NewClefSigner(ctx context.Context, endpoint string, address common.Address) (*ClefSigner, error) {
+	rpc, err := jsonrpc.NewEthClient(endpoint)
+	if err != nil {
+		return nil, xerrors.Errorf("signer: %w", err)
+	}
+	// 签名请求需要人工批准，重试会让同一笔交易再次弹出
+	rpc.Retries = 0
+
+	var version string
+	if err := rpc.Call(ctx, &version, "account_version"); err != nil {
+		rpc.Close()
+		return nil, xerrors.Errorf("signer %s: %w", endpoint, err)
+	}
+
+	if address == (common.Address{}) {
+		var accounts []common.Address
+		if err := rpc.Call(ctx, &accounts, "account_list"); err != nil {
+			rpc.Close()
+			return nil, xerrors.Errorf("signer %s: account_list: %w", endpoint, err)
+		}
+		if len(accounts) != 1 {
+			rpc.Close()
+			return nil, xerrors.Errorf("signer %s offers %d accounts, choose one with --account", endpoint, len(accounts))
+		}
+		address = accounts[0]
+	}
+	return &ClefSigner{rpc: rpc, address: address}, nil
+}
+
+func (s *ClefSigner) Address() common.Address {
+	return s.address
+}
+
+// clefTxArgs account_signTransaction 的参数，和 clef 的 apitypes.SendTxArgs 相同。
+type clefTxArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to,omitempty"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big     `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId,omitempty"`
+}
+
+type clefSignResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// SignTx 请求签名服务签名。签名服务批准时可以修改手续费和 gas，
+// 但发送账户、chain id、nonce、接收地址、金额和数据必须和请求一致。
+func (s *ClefSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := clefTxArgs{
+		From:    s.address,
+		To:      tx.To(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	var result clefSignResult
+	if err := s.rpc.Call(ctx, &result, "account_signTransaction", args); err != nil {
+		return nil, xerrors.Errorf("account_signTransaction: %w", err)
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, xerrors.Errorf("account_signTransaction: decode signed tx: %w", err)
+	}
+	if err := checkSigned(tx, signed, s.address, chainID); err != nil {
+		return nil, xerrors.Errorf("account_signTransaction: %w", err)
+	}
+	return signed, nil
+}
+
+// checkSigned 检查签名服务返回的交易和请求签名的交易是同一笔。
+func checkSigned(tx, signed *types.Transaction, from common.Address, chainID *big.Int) error {
+	sender, err := types.Sender(types.NewLondonSigner(chainID), signed)
+	if err != nil {
+		return xerrors.Errorf("signed tx: %w", err)
+	}
+	if sender != from {
+		return xerrors.Errorf("signed by %s, expected %s", sender.Hex(), from.Hex())
+	}
+	if signed.ChainId().Cmp(chainID) != 0 {
+		return xerrors.Errorf("signed for chain id %s, expected %s", signed.ChainId(), chainID)
+	}
+	if signed.Nonce() != tx.Nonce() {
+		return xerrors.Errorf("signed with nonce %d, expected %d", signed.Nonce(), tx.Nonce())
+	}
+	if (signed.To() == nil) != (tx.To() == nil) || (tx.To() != nil && *signed.To() != *tx.To()) {
+		return xerrors.New("the signer changed the recipient")
+	}
+	if signed.Value().Cmp(tx.Value()) != 0 || !bytes.Equal(signed.Data(), tx.Data()) {
+		return xerrors.New("the signer changed the value or data")
+	}
+	return nil
+}
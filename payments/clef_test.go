@@ -0,0 +1,207 @@
+package payments
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"geth-cli/jsonrpc"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeClef 用 httptest 模拟 clef 的 account_version、account_list 和 account_signTransaction。
+// tamper 不为空时在签名前修改请求，模拟被篡改或有问题的签名服务。
+type fakeClef struct {
+	key      *ecdsa.PrivateKey
+	accounts []common.Address
+	tamper   func(args *clefTxArgs)
+	// signKey 不为空时用它签名，模拟签名账户不对。
+	signKey *ecdsa.PrivateKey
+	deny    bool
+}
+
+func (f *fakeClef) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	var rpcErr *jsonrpc.StRpcRespError
+	switch req.Method {
+	case "account_version":
+		result = "6.1.0"
+	case "account_list":
+		result = f.accounts
+	case "account_signTransaction":
+		if f.deny {
+			rpcErr = &jsonrpc.StRpcRespError{Code: -32000, Message: "Request denied"}
+			break
+		}
+		var args clefTxArgs
+		if err := json.Unmarshal(req.Params[0], &args); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		raw, err := f.sign(args)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result = map[string]interface{}{"raw": hexutil.Bytes(raw)}
+	default:
+		http.Error(w, "unknown method "+req.Method, http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result, "error": rpcErr})
+}
+
+func (f *fakeClef) sign(args clefTxArgs) ([]byte, error) {
+	if f.tamper != nil {
+		f.tamper(&args)
+	}
+	var tx *types.Transaction
+	if args.MaxFeePerGas != nil {
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   args.ChainID.ToInt(),
+			Nonce:     uint64(args.Nonce),
+			GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(args.Gas),
+			To:        args.To,
+			Value:     args.Value.ToInt(),
+			Data:      args.Data,
+		})
+	} else {
+		tx = types.NewTransaction(uint64(args.Nonce), *args.To, args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), args.Data)
+	}
+
+	key := f.key
+	if f.signKey != nil {
+		key = f.signKey
+	}
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(args.ChainID.ToInt()), key)
+	if err != nil {
+		return nil, err
+	}
+	return signed.MarshalBinary()
+}
+
+func newFakeClef(t *testing.T, f *fakeClef) string {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func testTxs(to common.Address) []*types.Transaction {
+	return []*types.Transaction{
+		types.NewTx(&types.DynamicFeeTx{
+			ChainID:   testChainID,
+			Nonce:     7,
+			GasTipCap: big.NewInt(2e9),
+			GasFeeCap: big.NewInt(50e9),
+			Gas:       21000,
+			To:        &to,
+			Value:     big.NewInt(1e18),
+		}),
+		types.NewTransaction(8, to, big.NewInt(0), 60000, big.NewInt(30e9), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+	}
+}
+
+func TestClefSigner(t *testing.T) {
+	key, from := newTestKey(t)
+	_, to := newTestKey(t)
+	ctx := context.Background()
+	endpoint := newFakeClef(t, &fakeClef{key: key, accounts: []common.Address{from}})
+
+	// 没有指定账户时使用签名服务中唯一的账户
+	signer, err := NewClefSigner(ctx, endpoint, common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address() != from {
+		t.Fatalf("signer address %s, want %s", signer.Address().Hex(), from.Hex())
+	}
+
+	for _, tx := range testTxs(to) {
+		signed, err := signer.SignTx(ctx, tx, testChainID)
+		if err != nil {
+			t.Fatalf("type %d: %v", tx.Type(), err)
+		}
+		local, err := NewKeySigner(key).SignTx(ctx, tx, testChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed.Hash() != local.Hash() {
+			t.Errorf("type %d: clef signed %s, signing locally gives %s", tx.Type(), signed.Hash().Hex(), local.Hash().Hex())
+		}
+	}
+}
+
+func TestNewClefSignerAccounts(t *testing.T) {
+	_, a := newTestKey(t)
+	_, b := newTestKey(t)
+	ctx := context.Background()
+	endpoint := newFakeClef(t, &fakeClef{accounts: []common.Address{a, b}})
+
+	if _, err := NewClefSigner(ctx, endpoint, common.Address{}); err == nil || !strings.Contains(err.Error(), "offers 2 accounts") {
+		t.Errorf("no account chosen from 2: %v, want an error asking for --account", err)
+	}
+	signer, err := NewClefSigner(ctx, endpoint, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address() != b {
+		t.Errorf("signer address %s, want %s", signer.Address().Hex(), b.Hex())
+	}
+
+	if _, err := NewClefSigner(ctx, "http://127.0.0.1:1", a); err == nil {
+		t.Error("connected to an unreachable signer")
+	}
+}
+
+func TestClefSignerRejectsChangedTx(t *testing.T) {
+	key, from := newTestKey(t)
+	otherKey, other := newTestKey(t)
+	_, to := newTestKey(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name  string
+		clef  *fakeClef
+		error string
+	}{
+		{"recipient", &fakeClef{tamper: func(args *clefTxArgs) { args.To = &other }}, "changed the recipient"},
+		{"value", &fakeClef{tamper: func(args *clefTxArgs) { args.Value = hexutil.Big(*big.NewInt(5e18)) }}, "changed the value"},
+		{"data", &fakeClef{tamper: func(args *clefTxArgs) { args.Data = []byte{1} }}, "changed the value or data"},
+		{"nonce", &fakeClef{tamper: func(args *clefTxArgs) { args.Nonce++ }}, "signed with nonce"},
+		{"chain id", &fakeClef{tamper: func(args *clefTxArgs) { args.ChainID = (*hexutil.Big)(big.NewInt(1)) }}, "invalid chain id"},
+		{"signer", &fakeClef{signKey: otherKey}, "signed by " + other.Hex()},
+		{"denied", &fakeClef{deny: true}, "Request denied"},
+	} {
+		tt.clef.key = key
+		signer, err := NewClefSigner(ctx, newFakeClef(t, tt.clef), from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range testTxs(to) {
+			if _, err := signer.SignTx(ctx, tx, testChainID); err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("%s, type %d: %v, want an error containing %q", tt.name, tx.Type(), err, tt.error)
+			}
+		}
+	}
+}
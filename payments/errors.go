@@ -0,0 +1,94 @@
+package payments
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// 节点拒绝交易或无法访问时的错误类型，用 errors.Is 判断，原始错误仍可通过 errors.As 取得。
+var (
+	ErrInsufficientFunds = xerrors.New("insufficient funds")
+	ErrNonceTooLow       = xerrors.New("nonce too low")
+	ErrUnderpriced       = xerrors.New("transaction underpriced")
+	ErrRPCUnavailable    = xerrors.New("rpc unavailable")
+)
+
+// rpcErrorCode 节点返回的 JSON-RPC 错误（go-ethereum 的 rpc.Error 和 jsonrpc.StRpcRespError）。
+type rpcErrorCode interface {
+	ErrorCode() int
+}
+
+// gethErrors geth 交易池和执行交易时返回的错误信息。
+var gethErrors = []struct {
+	message string
+	kind    error
+}{
+	{"insufficient funds", ErrInsufficientFunds},
+	{"nonce too low", ErrNonceTooLow},
+	{"replacement transaction underpriced", ErrUnderpriced},
+	{"transaction underpriced", ErrUnderpriced},
+	{"less than block base fee", ErrUnderpriced},
+	{"execution reverted", ErrTxSimulationFailed},
+}
+
+// Error 带类型的错误，Kind 为上面的错误之一，Err 为节点返回的原始错误。
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ClassifyError 按 JSON-RPC 错误码、geth 的错误信息和网络错误判断错误类型并包装为 *Error，
+// 已经有类型或无法判断的错误原样返回。
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if xerrors.As(err, &typed) {
+		return err
+	}
+	for _, kind := range []error{ErrInsufficientFunds, ErrNonceTooLow, ErrUnderpriced, ErrRPCUnavailable, ErrTxSimulationFailed, ErrNoEIP1559} {
+		if xerrors.Is(err, kind) {
+			return err
+		}
+	}
+
+	var rpcErr rpcErrorCode
+	if xerrors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case 3:
+			return &Error{Kind: ErrTxSimulationFailed, Err: err}
+		case -32601:
+			return &Error{Kind: ErrRPCUnavailable, Err: err}
+		}
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, e := range gethErrors {
+		if strings.Contains(message, e.message) {
+			return &Error{Kind: e.kind, Err: err}
+		}
+	}
+
+	// net.Error 和 jsonrpc.HTTPError 都有 Temporary 方法
+	var transportErr interface{ Temporary() bool }
+	if xerrors.As(err, &transportErr) || xerrors.Is(err, io.EOF) || xerrors.Is(err, io.ErrUnexpectedEOF) || xerrors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrRPCUnavailable, Err: err}
+	}
+	return err
+}
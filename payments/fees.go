@@ -0,0 +1,163 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/xerrors"
+)
+
+// FeeOptions 手续费策略。
+type FeeOptions struct {
+	Legacy               bool
+	NGasPrice            uint64
+	MaxFeePerGas         *big.Int // nil 表示自动
+	MaxPriorityFeePerGas *big.Int // nil 表示自动
+	GasMargin            uint64   // 估算 gas 时增加的百分比
+}
+
+// TxFees 交易实际使用的手续费，GasPrice 非空时为按 gasPrice 计价的传统或 EIP-2930 交易，否则为 EIP-1559 交易。
+type TxFees struct {
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// SuggestFees 根据节点当前的 gas price 或 baseFee 计算手续费。
+func SuggestFees(ctx context.Context, backend Backend, opts FeeOptions) (*TxFees, error) {
+	if opts.Legacy {
+		price, err := backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &TxFees{GasPrice: price.Mul(price, new(big.Int).SetUint64(opts.NGasPrice))}, nil
+	}
+
+	header, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header.BaseFee == nil {
+		return nil, ErrNoEIP1559
+	}
+
+	tip := opts.MaxPriorityFeePerGas
+	if tip == nil {
+		tip, err = backend.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	feeCap := opts.MaxFeePerGas
+	if feeCap == nil {
+		feeCap = new(big.Int).Mul(header.BaseFee, new(big.Int).SetUint64(opts.NGasPrice))
+		feeCap.Add(feeCap, tip)
+	}
+
+	if feeCap.Cmp(tip) < 0 {
+		return nil, xerrors.Errorf("maxFeePerGas %s is lower than maxPriorityFeePerGas %s", feeCap, tip)
+	}
+
+	return &TxFees{GasFeeCap: feeCap, GasTipCap: tip}, nil
+}
+
+// TxFeesOf 返回交易的手续费。
+func TxFeesOf(tx *types.Transaction) *TxFees {
+	if tx.Type() != types.DynamicFeeTxType {
+		return &TxFees{GasPrice: tx.GasPrice()}
+	}
+	return &TxFees{GasFeeCap: tx.GasFeeCap(), GasTipCap: tx.GasTipCap()}
+}
+
+// ReplacementFees 计算替换 old 的手续费：max(建议价格 * nGasPrice, 原价格 * (1 + bump%))，
+// 传统交易比较 gasPrice，EIP-1559 交易分别比较 maxFeePerGas 和 maxPriorityFeePerGas。
+func ReplacementFees(ctx context.Context, backend Backend, old *TxFees, nGasPrice, bump uint64) (*TxFees, error) {
+	fees, err := SuggestFees(ctx, backend, FeeOptions{Legacy: old.GasPrice != nil, NGasPrice: nGasPrice})
+	if err != nil {
+		return nil, err
+	}
+
+	if old.GasPrice != nil {
+		fees.GasPrice = maxBig(fees.GasPrice, BumpGasPrice(old.GasPrice, bump))
+		return fees, nil
+	}
+
+	fees.GasTipCap = maxBig(fees.GasTipCap, BumpGasPrice(old.GasTipCap, bump))
+	fees.GasFeeCap = maxBig(fees.GasFeeCap, BumpGasPrice(old.GasFeeCap, bump), fees.GasTipCap)
+	return fees, nil
+}
+
+// BumpGasPrice 返回比 old 至少高 bump% 的价格（向上取整），满足节点替换交易的最低涨幅。
+func BumpGasPrice(old *big.Int, bump uint64) *big.Int {
+	bumped := new(big.Int).Mul(old, new(big.Int).SetUint64(100+bump))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func maxBig(first *big.Int, rest ...*big.Int) *big.Int {
+	m := first
+	for _, v := range rest {
+		if v.Cmp(m) > 0 {
+			m = v
+		}
+	}
+	return m
+}
+
+// NewTx 按手续费类型构造未签名的交易。
+func (f *TxFees) NewTx(chainID *big.Int, nonce uint64, to common.Address, value *big.Int, gasLimit uint64, data []byte) *types.Transaction {
+	if f.GasPrice != nil {
+		return types.NewTransaction(nonce, to, value, gasLimit, f.GasPrice, data)
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: f.GasTipCap,
+		GasFeeCap: f.GasFeeCap,
+		Gas:       gasLimit,
+		To:        &to,
+		Value:     value,
+		Data:      data,
+	})
+}
+
+// replacementTx 用新的手续费和 gas limit 构造替换 old 的交易，保留原交易的类型和 access list。
+func (f *TxFees) replacementTx(chainID *big.Int, old *types.Transaction, gasLimit uint64) *types.Transaction {
+	switch {
+	case old.Type() == types.AccessListTxType && f.GasPrice != nil:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      old.Nonce(),
+			GasPrice:   f.GasPrice,
+			Gas:        gasLimit,
+			To:         old.To(),
+			Value:      old.Value(),
+			Data:       old.Data(),
+			AccessList: old.AccessList(),
+		})
+	case old.Type() == types.DynamicFeeTxType && f.GasPrice == nil:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      old.Nonce(),
+			GasTipCap:  f.GasTipCap,
+			GasFeeCap:  f.GasFeeCap,
+			Gas:        gasLimit,
+			To:         old.To(),
+			Value:      old.Value(),
+			Data:       old.Data(),
+			AccessList: old.AccessList(),
+		})
+	}
+	return f.NewTx(chainID, old.Nonce(), *old.To(), old.Value(), gasLimit, old.Data())
+}
+
+func (f *TxFees) String() string {
+	if f.GasPrice != nil {
+		return fmt.Sprintf("gasPrice: %s", f.GasPrice)
+	}
+	return fmt.Sprintf("maxFeePerGas: %s, maxPriorityFeePerGas: %s", f.GasFeeCap, f.GasTipCap)
+}
@@ -0,0 +1,66 @@
+package payments
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/xerrors"
+)
+
+// EstimateGas 以 msg.From 的身份估算 gas，交易会失败时返回带 revert 原因的 ErrTxSimulationFailed。
+// gasLimit 不为 0 时直接使用，低于估算值时同样返回 ErrTxSimulationFailed；否则在估算值上增加 margin 百分比的余量。
+// 返回使用的 gas limit 和估算值。
+func EstimateGas(ctx context.Context, backend Backend, msg ethereum.CallMsg, gasLimit, margin uint64) (uint64, uint64, error) {
+	estimate, err := backend.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, 0, SimulationError("estimate gas", err)
+	}
+
+	if gasLimit > 0 {
+		if gasLimit < estimate {
+			return 0, estimate, xerrors.Errorf("gas limit %d is below the estimate %d: %w", gasLimit, estimate, ErrTxSimulationFailed)
+		}
+		return gasLimit, estimate, nil
+	}
+	return estimate + estimate*margin/100, estimate, nil
+}
+
+// SimulationError 节点执行交易返回的错误说明交易会失败，包装为 ErrTxSimulationFailed；连接等其他错误原样返回。
+func SimulationError(what string, err error) error {
+	if _, ok := err.(rpc.Error); !ok {
+		return xerrors.Errorf("%s: %w", what, err)
+	}
+	// 例如余额不足，比交易会失败更具体
+	if classified := ClassifyError(err); classified != err && !xerrors.Is(classified, ErrTxSimulationFailed) {
+		return xerrors.Errorf("%s: %w", what, classified)
+	}
+	return xerrors.Errorf("%s: %s: %w", what, RevertReason(err), ErrTxSimulationFailed)
+}
+
+// RevertReason 解码节点返回的 revert 数据（Error(string)），例如 "execution reverted: ERC20: transfer amount exceeds balance"。
+func RevertReason(err error) string {
+	dataErr, ok := err.(rpc.DataError)
+	if !ok {
+		return err.Error()
+	}
+	hex, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err.Error()
+	}
+	data, decodeErr := hexutil.Decode(hex)
+	if decodeErr != nil {
+		return err.Error()
+	}
+	reason, unpackErr := abi.UnpackRevert(data)
+	if unpackErr != nil {
+		return err.Error()
+	}
+	if strings.Contains(err.Error(), reason) {
+		return err.Error()
+	}
+	return err.Error() + ": " + reason
+}
@@ -0,0 +1,77 @@
+// Package payments 构造、签名并发送 ETH 和 ERC-20 代币交易，可以在其他 Go 服务中使用。
+// 节点通过 Backend 注入（*ethclient.Client 或测试用的 backends.SimulatedBackend），
+// 私钥通过 Signer 注入，所有方法都接受 context.Context 并返回错误而不是退出进程，
+// 节点拒绝交易的常见原因可以用 errors.Is 判断（见 ClassifyError）。
+package payments
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+
+	token "geth-cli/erc20-token"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"golang.org/x/xerrors"
+)
+
+// Backend Sender 需要的节点接口。
+type Backend interface {
+	bind.ContractBackend
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+var _ Backend = (*ethclient.Client)(nil)
+
+// Signer 为交易签名，实现可以是本地私钥，也可以是外部签名服务。
+type Signer interface {
+	// Address 签名账户的地址。
+	Address() common.Address
+	// SignTx 按 chainID 签名交易，返回签名后的交易。
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// KeySigner 使用内存中的私钥签名。
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *KeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *KeySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.NewLondonSigner(chainID), s.key)
+}
+
+var (
+	// ErrTxSimulationFailed 节点模拟执行交易失败（例如 revert），交易发送后也会失败。
+	ErrTxSimulationFailed = xerrors.New("transaction would fail")
+	// ErrNoEIP1559 链不支持 EIP-1559，需要使用传统交易。
+	ErrNoEIP1559 = xerrors.New("the chain does not support EIP-1559 (no baseFeePerGas)")
+)
+
+// TokenABI ERC-20 合约的 ABI。
+var TokenABI = mustParseABI(token.TokenABI)
+
+// mustParseABI 解析编译进程序的 ABI，格式错误时 panic。
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
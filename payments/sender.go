@@ -0,0 +1,258 @@
+package payments
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/xerrors"
+)
+
+// NonceSource 为发送账户分配 nonce。Done 在交易发送后调用，sendErr 不为空表示交易没有发送出去。
+type NonceSource interface {
+	Reserve(ctx context.Context, from common.Address) (uint64, error)
+	Done(from common.Address, nonce uint64, hash common.Hash, sendErr error)
+}
+
+// PendingNonces 使用节点的 pending nonce，同一账户的并发发送需要自己保证不冲突。
+type PendingNonces struct {
+	Backend Backend
+}
+
+func (n PendingNonces) Reserve(ctx context.Context, from common.Address) (uint64, error) {
+	return n.Backend.PendingNonceAt(ctx, from)
+}
+
+func (n PendingNonces) Done(common.Address, uint64, common.Hash, error) {}
+
+// Sender 用一个账户构造、签名并发送交易。只调用 Build 时 Signer 可以为空。
+type Sender struct {
+	Backend Backend
+	Signer  Signer
+	From    common.Address
+	ChainID *big.Int
+	// Fees 新交易的手续费策略。
+	Fees FeeOptions
+	// Nonces 默认为 PendingNonces。
+	Nonces NonceSource
+	// Broadcast 发送签名后的交易，默认为 Backend.SendTransaction，可以替换为只模拟不发送。
+	Broadcast func(ctx context.Context, tx *types.Transaction) error
+}
+
+// NewSender chainID 应为节点的 eth_chainId，交易按它签名。
+func NewSender(backend Backend, signer Signer, chainID *big.Int) *Sender {
+	return &Sender{
+		Backend: backend,
+		Signer:  signer,
+		From:    signer.Address(),
+		ChainID: chainID,
+		Fees:    FeeOptions{NGasPrice: 2, GasMargin: 20},
+	}
+}
+
+// Result 已发送的交易。
+type Result struct {
+	Tx   *types.Transaction
+	From common.Address
+	Fees *TxFees
+	// Estimate 节点估算的 gas，GasLimit 为实际使用的值。
+	Estimate uint64
+	GasLimit uint64
+	// OldFees 替换交易时原交易的手续费。
+	OldFees *TxFees
+}
+
+func (r *Result) Hash() common.Hash {
+	return r.Tx.Hash()
+}
+
+// Unsigned 构造的未签名交易和它占用的 nonce。
+type Unsigned struct {
+	Result
+	// Done 发送后调用，记录结果或释放 nonce。
+	Done func(hash common.Hash, sendErr error)
+}
+
+// Build 估算 gas、计算手续费并分配 nonce，构造未签名的交易。gasLimit 为 0 时使用估算值加 Fees.GasMargin。
+// 调用方必须调用返回值的 Done；不发送也不调用 Done 时，nonce 由 NonceSource 决定是否保留。
+func (s *Sender) Build(ctx context.Context, to common.Address, value *big.Int, data []byte, gasLimit uint64) (*Unsigned, error) {
+	from := s.From
+	gasLimit, estimate, err := EstimateGas(ctx, s.Backend, ethereum.CallMsg{From: from, To: &to, Value: value, Data: data}, gasLimit, s.Fees.GasMargin)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	fees, err := SuggestFees(ctx, s.Backend, s.Fees)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	nonces := s.nonces()
+	nonce, err := nonces.Reserve(ctx, from)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return &Unsigned{
+		Result: Result{
+			Tx:       fees.NewTx(s.ChainID, nonce, to, value, gasLimit, data),
+			From:     from,
+			Fees:     fees,
+			Estimate: estimate,
+			GasLimit: gasLimit,
+		},
+		Done: func(hash common.Hash, sendErr error) {
+			nonces.Done(from, nonce, hash, sendErr)
+		},
+	}, nil
+}
+
+// Transact 构造、签名并发送一笔交易。
+func (s *Sender) Transact(ctx context.Context, to common.Address, value *big.Int, data []byte, gasLimit uint64) (*Result, error) {
+	u, err := s.Build(ctx, to, value, data, gasLimit)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return s.signAndSend(ctx, u)
+}
+
+// signAndSend 签名并发送 Build 构造的交易，然后调用 u.Done。
+func (s *Sender) signAndSend(ctx context.Context, u *Unsigned) (*Result, error) {
+	signedTx, err := s.Signer.SignTx(ctx, u.Tx, s.ChainID)
+	if err != nil {
+		u.Done(common.Hash{}, err)
+		return nil, ClassifyError(err)
+	}
+
+	err = s.broadcast(ctx, signedTx)
+	u.Done(signedTx.Hash(), err)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	u.Tx = signedTx
+	return &u.Result, nil
+}
+
+// SendETH 转账 amount wei 到 to。
+func (s *Sender) SendETH(ctx context.Context, to common.Address, amount *big.Int, gasLimit uint64) (*Result, error) {
+	return s.Transact(ctx, to, amount, nil, gasLimit)
+}
+
+// SendToken 调用代币合约的 transfer 方法，amount 为代币的最小单位。
+func (s *Sender) SendToken(ctx context.Context, token, to common.Address, amount *big.Int, gasLimit uint64) (*Result, error) {
+	data, err := TokenABI.Pack("transfer", to, amount)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return s.Transact(ctx, token, big.NewInt(0), data, gasLimit)
+}
+
+// ReplaceOptions 替换交易的手续费和 gas limit。
+type ReplaceOptions struct {
+	// NGasPrice 新价格至少为当前建议价格的倍数。
+	NGasPrice uint64
+	// Bump 新价格比原交易至少高的百分比，geth 默认要求 10。
+	Bump uint64
+	// GasLimit 大于原交易的 gas limit 时使用。
+	GasLimit uint64
+}
+
+// Replace 用更高的手续费重新签名发送 old（相同的 nonce、收款地址、金额、数据、交易类型和 access list），old 必须是 s.From 发送的交易。
+func (s *Sender) Replace(ctx context.Context, old *types.Transaction, opts ReplaceOptions) (*Result, error) {
+	if old.To() == nil {
+		return nil, xerrors.Errorf("nonce %d: cannot replace a contract creation", old.Nonce())
+	}
+
+	if err := s.checkSender(old); err != nil {
+		return nil, err
+	}
+
+	oldFees := TxFeesOf(old)
+	fees, err := ReplacementFees(ctx, s.Backend, oldFees, opts.NGasPrice, opts.Bump)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	gasLimit := old.Gas()
+	if opts.GasLimit > gasLimit {
+		gasLimit = opts.GasLimit
+	}
+
+	result, err := s.send(ctx, fees.replacementTx(s.ChainID, old, gasLimit))
+	if result != nil {
+		result.OldFees = oldFees
+	}
+	return result, ClassifyError(err)
+}
+
+// checkSender 确认 old 是 s.From 发送的交易。
+func (s *Sender) checkSender(old *types.Transaction) error {
+	sender, err := types.Sender(types.LatestSignerForChainID(s.ChainID), old)
+	if err != nil {
+		return xerrors.Errorf("nonce %d: %w", old.Nonce(), err)
+	}
+	if sender != s.From {
+		return xerrors.Errorf("nonce %d: the transaction is from %s, not %s", old.Nonce(), sender.Hex(), s.From.Hex())
+	}
+	return nil
+}
+
+// Cancel 用 0 金额转给自己的交易占用 nonce：old 不为空时按 Replace 的规则提高手续费替换它（old 必须是 s.From 发送的交易），
+// 为空时（例如填补 nonce 空缺）使用 Fees 计算手续费。
+func (s *Sender) Cancel(ctx context.Context, nonce uint64, old *types.Transaction, opts ReplaceOptions) (*Result, error) {
+	var oldFees, fees *TxFees
+	var err error
+	if old != nil {
+		if err := s.checkSender(old); err != nil {
+			return nil, err
+		}
+		oldFees = TxFeesOf(old)
+		fees, err = ReplacementFees(ctx, s.Backend, oldFees, opts.NGasPrice, opts.Bump)
+	} else {
+		fees, err = SuggestFees(ctx, s.Backend, s.Fees)
+	}
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	gasLimit := opts.GasLimit
+	if gasLimit == 0 {
+		gasLimit = 21000
+	}
+
+	result, err := s.send(ctx, fees.NewTx(s.ChainID, nonce, s.From, big.NewInt(0), gasLimit, nil))
+	if result != nil {
+		result.OldFees = oldFees
+	}
+	return result, ClassifyError(err)
+}
+
+// send 签名并发送使用指定 nonce 的交易，发送失败时也返回签名后的交易。
+func (s *Sender) send(ctx context.Context, tx *types.Transaction) (*Result, error) {
+	signedTx, err := s.Signer.SignTx(ctx, tx, s.ChainID)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	result := &Result{Tx: signedTx, From: s.From, Fees: TxFeesOf(signedTx), GasLimit: signedTx.Gas()}
+	err = s.broadcast(ctx, signedTx)
+	s.nonces().Done(result.From, signedTx.Nonce(), signedTx.Hash(), err)
+	return result, ClassifyError(err)
+}
+
+func (s *Sender) broadcast(ctx context.Context, tx *types.Transaction) error {
+	if s.Broadcast != nil {
+		return s.Broadcast(ctx, tx)
+	}
+	return s.Backend.SendTransaction(ctx, tx)
+}
+
+func (s *Sender) nonces() NonceSource {
+	if s.Nonces != nil {
+		return s.Nonces
+	}
+	return PendingNonces{Backend: s.Backend}
+}
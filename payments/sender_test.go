@@ -0,0 +1,441 @@
+package payments
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io"
+	"math/big"
+	"testing"
+
+	"geth-cli/jsonrpc"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"golang.org/x/xerrors"
+)
+
+var _ Backend = (*backends.SimulatedBackend)(nil)
+
+// testChainID SimulatedBackend 的 chain id。
+var testChainID = params.AllEthashProtocolChanges.ChainID
+
+// testTokenCode 最小的代币合约（运行时字节码）：balanceOf、transfer（余额不足时 revert）、decimals、symbol、name、totalSupply，
+// 余额存放在以地址为 key 的 storage 中。
+const testTokenCode = "0x60003560e01c806370a082311461004c578063a9059cbb146100e0578063313ce5671461005957806395d89b411461007857806306fdde03146100ac57806318160ddd1461006457600080fd5b6004355460005260206000f35b601260005260206000f35b69d3c21bcecceda100000060005260206000f35b602060005260036020527f545354000000000000000000000000000000000000000000000000000000000060405260606000f35b6020600052600a6020527f5465737420546f6b656e0000000000000000000000000000000000000000000060405260606000f35b602435803354106101065780335403335580600435540160043555600160005260206000f35b600080fd"
+
+// poolBackend 在 SimulatedBackend 前加上 geth 交易池对同一 nonce 的替换规则。
+// SimulatedBackend 没有交易池，重复的 nonce 会直接 panic；这里返回的错误与 geth 节点相同。
+type poolBackend struct {
+	*backends.SimulatedBackend
+	pending []*types.Transaction
+}
+
+func newPoolBackend(t *testing.T, alloc core.GenesisAlloc) *poolBackend {
+	sim := backends.NewSimulatedBackend(alloc, 8000000)
+	t.Cleanup(func() { sim.Close() })
+	return &poolBackend{SimulatedBackend: sim}
+}
+
+func (b *poolBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	signer := types.LatestSignerForChainID(testChainID)
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return err
+	}
+	nonce, err := b.NonceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if tx.Nonce() < nonce {
+		return core.ErrNonceTooLow
+	}
+	balance, err := b.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(tx.Cost()) < 0 {
+		return core.ErrInsufficientFunds
+	}
+
+	for i, old := range b.pending {
+		if oldFrom, _ := types.Sender(signer, old); oldFrom != from || old.Nonce() != tx.Nonce() {
+			continue
+		}
+		// 与 geth 的 core/tx_list.go 相同：maxFeePerGas 和 maxPriorityFeePerGas 都要至少高 10%
+		if !outbids(old.GasFeeCap(), tx.GasFeeCap()) || !outbids(old.GasTipCap(), tx.GasTipCap()) {
+			return core.ErrReplaceUnderpriced
+		}
+		b.pending[i] = tx
+		b.SimulatedBackend.Rollback()
+		for _, p := range b.pending {
+			if err := b.SimulatedBackend.SendTransaction(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := b.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	b.pending = append(b.pending, tx)
+	return nil
+}
+
+func outbids(old, price *big.Int) bool {
+	threshold := new(big.Int).Mul(old, big.NewInt(110))
+	threshold.Div(threshold, big.NewInt(100))
+	return price.Cmp(old) > 0 && price.Cmp(threshold) >= 0
+}
+
+// SuggestGasPrice 与 geth 的 eth_gasPrice 一样返回 baseFee 加小费，SimulatedBackend 总是返回 1，低于 baseFee。
+func (b *poolBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	header, err := b.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := b.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tip.Add(tip, header.BaseFee), nil
+}
+
+func (b *poolBackend) Commit() {
+	b.SimulatedBackend.Commit()
+	b.pending = nil
+}
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, common.Address) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.Ether))
+}
+
+func balanceOf(t *testing.T, backend Backend, address common.Address) *big.Int {
+	balance, err := backend.BalanceAt(context.Background(), address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func requireMined(t *testing.T, backend Backend, hash common.Hash) {
+	// SimulatedBackend 找不到收据时返回 nil, nil
+	receipt, err := backend.TransactionReceipt(context.Background(), hash)
+	if err != nil || receipt == nil {
+		t.Fatalf("transaction %s was not mined: %v", hash.Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction %s failed", hash.Hex())
+	}
+}
+
+func TestSendETH(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		key, from := newTestKey(t)
+		_, to := newTestKey(t)
+		backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(10)}})
+		ctx := context.Background()
+
+		sender := NewSender(backend, NewKeySigner(key), testChainID)
+		sender.Fees.Legacy = legacy
+		result, err := sender.SendETH(ctx, to, ether(1), 0)
+		if err != nil {
+			t.Fatalf("legacy=%v: %v", legacy, err)
+		}
+		if wantType := map[bool]uint8{false: types.DynamicFeeTxType, true: types.LegacyTxType}[legacy]; result.Tx.Type() != wantType {
+			t.Errorf("legacy=%v: transaction type %d, want %d", legacy, result.Tx.Type(), wantType)
+		}
+		if result.Estimate != params.TxGas || result.GasLimit != params.TxGas*120/100 {
+			t.Errorf("legacy=%v: estimate %d gas limit %d, want %d and 20%% margin", legacy, result.Estimate, result.GasLimit, params.TxGas)
+		}
+
+		backend.Commit()
+		requireMined(t, backend, result.Hash())
+		if balance := balanceOf(t, backend, to); balance.Cmp(ether(1)) != 0 {
+			t.Errorf("legacy=%v: receiver balance %s, want %s", legacy, balance, ether(1))
+		}
+	}
+}
+
+func TestSendToken(t *testing.T) {
+	key, from := newTestKey(t)
+	_, to := newTestKey(t)
+	token := common.HexToAddress("0x00000000000000000000000000000000000070c3")
+	backend := newPoolBackend(t, core.GenesisAlloc{
+		from: {Balance: ether(10)},
+		token: {
+			Balance: new(big.Int),
+			Code:    common.FromHex(testTokenCode),
+			Storage: map[common.Hash]common.Hash{common.BytesToHash(from.Bytes()): common.BigToHash(big.NewInt(1000))},
+		},
+	})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+
+	result, err := sender.SendToken(ctx, token, to, big.NewInt(400), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	requireMined(t, backend, result.Hash())
+
+	for address, want := range map[common.Address]int64{from: 600, to: 400} {
+		balance, err := TokenBalance(ctx, backend, token, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Int64() != want {
+			t.Errorf("token balance of %s: %s, want %d", address.Hex(), balance, want)
+		}
+	}
+
+	// 超过余额的转账在估算 gas 时 revert，不会发送
+	if _, err := sender.SendToken(ctx, token, to, big.NewInt(601), 0); !xerrors.Is(err, ErrTxSimulationFailed) {
+		t.Errorf("transfer above the balance: %v, want ErrTxSimulationFailed", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	key, from := newTestKey(t)
+	otherKey, other := newTestKey(t)
+	_, to := newTestKey(t)
+	backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(10)}, other: {Balance: ether(10)}})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+
+	first, err := sender.SendETH(ctx, to, ether(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sender.Replace(ctx, first.Tx, ReplaceOptions{NGasPrice: 2, Bump: 5}); !xerrors.Is(err, ErrUnderpriced) {
+		t.Fatalf("replacement with a 5%% bump: %v, want ErrUnderpriced", err)
+	}
+	if _, err := NewSender(backend, NewKeySigner(otherKey), testChainID).Replace(ctx, first.Tx, ReplaceOptions{NGasPrice: 2, Bump: 10}); err == nil {
+		t.Fatal("replaced a transaction of another account")
+	}
+
+	replaced, err := sender.Replace(ctx, first.Tx, ReplaceOptions{NGasPrice: 2, Bump: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.Tx.Nonce() != first.Tx.Nonce() || replaced.OldFees.GasFeeCap.Cmp(first.Tx.GasFeeCap()) != 0 {
+		t.Fatalf("replacement nonce %d old fees %s, want nonce %d and the fees of the first transaction", replaced.Tx.Nonce(), replaced.OldFees, first.Tx.Nonce())
+	}
+
+	backend.Commit()
+	requireMined(t, backend, replaced.Hash())
+	if receipt, _ := backend.TransactionReceipt(ctx, first.Hash()); receipt != nil {
+		t.Error("the replaced transaction was mined")
+	}
+	if balance := balanceOf(t, backend, to); balance.Cmp(ether(1)) != 0 {
+		t.Errorf("receiver balance %s, want %s", balance, ether(1))
+	}
+}
+
+func TestReplaceKeepsTypeAndAccessList(t *testing.T) {
+	key, from := newTestKey(t)
+	_, to := newTestKey(t)
+	backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(10)}})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+	accessList := types.AccessList{{Address: to, StorageKeys: []common.Hash{{1}}}}
+
+	fees, err := SuggestFees(ctx, backend, FeeOptions{NGasPrice: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []*types.Transaction{
+		types.NewTx(&types.AccessListTx{ChainID: testChainID, Nonce: 0, GasPrice: fees.GasFeeCap, Gas: 30000, To: &to, Value: ether(1), AccessList: accessList}),
+		types.NewTx(&types.DynamicFeeTx{ChainID: testChainID, Nonce: 1, GasTipCap: fees.GasTipCap, GasFeeCap: fees.GasFeeCap, Gas: 30000, To: &to, Value: ether(1), AccessList: accessList}),
+	} {
+		signed, err := NewKeySigner(key).SignTx(ctx, tx, testChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.SendTransaction(ctx, signed); err != nil {
+			t.Fatal(err)
+		}
+
+		replaced, err := sender.Replace(ctx, signed, ReplaceOptions{NGasPrice: 2, Bump: 10})
+		if err != nil {
+			t.Fatalf("type %d: %v", tx.Type(), err)
+		}
+		if replaced.Tx.Type() != tx.Type() || len(replaced.Tx.AccessList()) != 1 || replaced.Tx.AccessList()[0].Address != to {
+			t.Errorf("type %d replaced by type %d with access list %v", tx.Type(), replaced.Tx.Type(), replaced.Tx.AccessList())
+		}
+	}
+
+	backend.Commit()
+	if balance := balanceOf(t, backend, to); balance.Cmp(ether(2)) != 0 {
+		t.Errorf("receiver balance %s, want %s", balance, ether(2))
+	}
+}
+
+func TestCancel(t *testing.T) {
+	key, from := newTestKey(t)
+	otherKey, other := newTestKey(t)
+	_, to := newTestKey(t)
+	backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(10)}, other: {Balance: ether(10)}})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+
+	first, err := sender.SendETH(ctx, to, ether(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSender(backend, NewKeySigner(otherKey), testChainID).Cancel(ctx, first.Tx.Nonce(), first.Tx, ReplaceOptions{NGasPrice: 2, Bump: 10}); err == nil {
+		t.Fatal("cancelled a transaction of another account")
+	}
+	cancel, err := sender.Cancel(ctx, first.Tx.Nonce(), first.Tx, ReplaceOptions{NGasPrice: 2, Bump: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cancel.Tx.To() != from || cancel.Tx.Value().Sign() != 0 {
+		t.Fatalf("cancel sends %s wei to %s, want 0 to %s", cancel.Tx.Value(), cancel.Tx.To().Hex(), from.Hex())
+	}
+
+	backend.Commit()
+	requireMined(t, backend, cancel.Hash())
+	if balance := balanceOf(t, backend, to); balance.Sign() != 0 {
+		t.Errorf("receiver balance %s after cancel, want 0", balance)
+	}
+}
+
+func TestSweepETH(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		key, from := newTestKey(t)
+		_, to := newTestKey(t)
+		backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(1)}})
+		ctx := context.Background()
+		sender := NewSender(backend, NewKeySigner(key), testChainID)
+		sender.Fees.Legacy = legacy
+
+		header, err := backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, amount, err := sender.SweepETH(ctx, to)
+		if err != nil {
+			t.Fatalf("legacy=%v: %v", legacy, err)
+		}
+		// baseFee 加上模拟节点建议的 1 wei 小费，不按 NGasPrice 放大
+		price := new(big.Int).Add(header.BaseFee, big.NewInt(1))
+		if legacy && result.Tx.GasPrice().Cmp(price) != 0 || !legacy && (result.Tx.GasFeeCap().Cmp(price) != 0 || result.Tx.GasTipCap().Cmp(price) != 0) {
+			t.Errorf("legacy=%v: fees %s, want %s", legacy, result.Fees, price)
+		}
+		if _, _, err := sender.SweepETH(ctx, to); err == nil {
+			t.Fatalf("legacy=%v: swept again with a pending transaction", legacy)
+		}
+
+		backend.Commit()
+		requireMined(t, backend, result.Hash())
+		if balance := balanceOf(t, backend, from); balance.Sign() != 0 {
+			t.Errorf("legacy=%v: %s wei left after the sweep", legacy, balance)
+		}
+		if balance := balanceOf(t, backend, to); balance.Cmp(amount) != 0 {
+			t.Errorf("legacy=%v: receiver balance %s, want %s", legacy, balance, amount)
+		}
+
+		if _, _, err := sender.SweepETH(ctx, to); !xerrors.Is(err, ErrNothingToSweep) {
+			t.Errorf("legacy=%v: sweeping an empty account: %v, want ErrNothingToSweep", legacy, err)
+		}
+	}
+}
+
+func TestSweepETHKeepsTip(t *testing.T) {
+	key, from := newTestKey(t)
+	_, to := newTestKey(t)
+	backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(1)}})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+	sender.Fees.MaxPriorityFeePerGas = big.NewInt(3)
+
+	header, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _, err := sender.SweepETH(ctx, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeCap := new(big.Int).Add(header.BaseFee, big.NewInt(3)); result.Tx.GasTipCap().Int64() != 3 || result.Tx.GasFeeCap().Cmp(feeCap) != 0 {
+		t.Errorf("fees %s, want maxFeePerGas %s and the given maxPriorityFeePerGas 3", result.Fees, feeCap)
+	}
+	backend.Commit()
+	requireMined(t, backend, result.Hash())
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		kind error
+	}{
+		{core.ErrNonceTooLow, ErrNonceTooLow},
+		{core.ErrInsufficientFunds, ErrInsufficientFunds},
+		{core.ErrReplaceUnderpriced, ErrUnderpriced},
+		{core.ErrUnderpriced, ErrUnderpriced},
+		{core.ErrFeeCapTooLow, ErrUnderpriced},
+		// 经 JSON-RPC 返回的节点错误只剩下错误码和错误信息
+		{&jsonrpc.StRpcRespError{Code: -32000, Message: core.ErrNonceTooLow.Error()}, ErrNonceTooLow},
+		{&jsonrpc.StRpcRespError{Code: -32000, Message: core.ErrReplaceUnderpriced.Error()}, ErrUnderpriced},
+		{&jsonrpc.StRpcRespError{Code: 3, Message: "execution reverted: insufficient balance"}, ErrTxSimulationFailed},
+		{&jsonrpc.StRpcRespError{Code: -32601, Message: "the method eth_feeHistory does not exist/is not available"}, ErrRPCUnavailable},
+		{&jsonrpc.HTTPError{StatusCode: 502, Body: "bad gateway"}, ErrRPCUnavailable},
+		{io.ErrUnexpectedEOF, ErrRPCUnavailable},
+	} {
+		err := ClassifyError(tt.err)
+		if !xerrors.Is(err, tt.kind) {
+			t.Errorf("ClassifyError(%v) = %v, want %v", tt.err, err, tt.kind)
+		}
+		if !xerrors.Is(err, tt.err) {
+			t.Errorf("ClassifyError(%v) lost the original error", tt.err)
+		}
+	}
+
+	if err := xerrors.New("boom"); ClassifyError(err) != err {
+		t.Error("an unknown error was wrapped")
+	}
+
+	// 模拟节点返回的错误
+	key, from := newTestKey(t)
+	_, to := newTestKey(t)
+	backend := newPoolBackend(t, core.GenesisAlloc{from: {Balance: ether(1)}})
+	ctx := context.Background()
+	sender := NewSender(backend, NewKeySigner(key), testChainID)
+
+	if _, err := sender.SendETH(ctx, to, ether(2), 0); !xerrors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("sending more than the balance: %v, want ErrInsufficientFunds", err)
+	}
+
+	first, err := sender.SendETH(ctx, to, big.NewInt(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	sender.Nonces = fixedNonce(first.Tx.Nonce())
+	if _, err := sender.SendETH(ctx, to, big.NewInt(1), 0); !xerrors.Is(err, ErrNonceTooLow) {
+		t.Errorf("reusing a mined nonce: %v, want ErrNonceTooLow", err)
+	}
+}
+
+// fixedNonce 总是分配同一个 nonce。
+type fixedNonce uint64
+
+func (n fixedNonce) Reserve(context.Context, common.Address) (uint64, error) {
+	return uint64(n), nil
+}
+
+func (n fixedNonce) Done(common.Address, uint64, common.Hash, error) {}
@@ -0,0 +1,130 @@
+package payments
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/xerrors"
+)
+
+// ErrNothingToSweep 余额为 0，或 ETH 余额不够支付转出的手续费。
+var ErrNothingToSweep = xerrors.New("nothing to sweep")
+
+// TokenBalance 读取 owner 的代币余额（最小单位）。
+func TokenBalance(ctx context.Context, backend Backend, token, owner common.Address) (*big.Int, error) {
+	data, err := TokenABI.Pack("balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	out, err := backend.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	if len(out) == 0 {
+		return nil, xerrors.Errorf("token %s: empty balanceOf result, not a token contract", token.Hex())
+	}
+	return new(big.Int).SetBytes(out), nil
+}
+
+// SweepToken 把全部代币余额转到 to，余额为 0 时返回 ErrNothingToSweep。
+func (s *Sender) SweepToken(ctx context.Context, token, to common.Address, gasLimit uint64) (*Result, *big.Int, error) {
+	balance, err := TokenBalance(ctx, s.Backend, token, s.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	if balance.Sign() == 0 {
+		return nil, balance, ErrNothingToSweep
+	}
+	result, err := s.SendToken(ctx, token, to, balance, gasLimit)
+	return result, balance, err
+}
+
+// SweepETH 把 ETH 余额扣除手续费后全部转到 to，转出金额为 balance - gasLimit*gasPrice，手续费见 sweepFees。
+// 账户有未上链的交易时余额还会变化，返回错误；to 是合约且没有用完 gas limit 时，退回的 gas 会留在账户中。
+func (s *Sender) SweepETH(ctx context.Context, to common.Address) (*Result, *big.Int, error) {
+	latest, err := s.Backend.NonceAt(ctx, s.From, nil)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+	pending, err := s.Backend.PendingNonceAt(ctx, s.From)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+	if pending != latest {
+		return nil, nil, xerrors.Errorf("%s has %d pending transactions, sweep after they are mined", s.From.Hex(), pending-latest)
+	}
+
+	balance, err := s.Backend.BalanceAt(ctx, s.From, nil)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+	if balance.Sign() == 0 {
+		return nil, nil, ErrNothingToSweep
+	}
+
+	gasLimit, estimate, err := EstimateGas(ctx, s.Backend, ethereum.CallMsg{From: s.From, To: &to, Value: balance}, 0, 0)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+
+	fees, err := sweepFees(ctx, s.Backend, s.Fees)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+	price := fees.GasPrice
+	if price == nil {
+		price = fees.GasFeeCap
+	}
+
+	fee := new(big.Int).Mul(price, new(big.Int).SetUint64(gasLimit))
+	if balance.Cmp(fee) <= 0 {
+		return nil, nil, xerrors.Errorf("balance %s wei does not cover the fee %s wei: %w", balance, fee, ErrNothingToSweep)
+	}
+	amount := new(big.Int).Sub(balance, fee)
+
+	nonces := s.nonces()
+	nonce, err := nonces.Reserve(ctx, s.From)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+	from := s.From
+	result, err := s.signAndSend(ctx, &Unsigned{
+		Result: Result{
+			Tx:       fees.NewTx(s.ChainID, nonce, to, amount, gasLimit, nil),
+			From:     from,
+			Fees:     fees,
+			Estimate: estimate,
+			GasLimit: gasLimit,
+		},
+		Done: func(hash common.Hash, sendErr error) {
+			nonces.Done(from, nonce, hash, sendErr)
+		},
+	})
+	return result, amount, err
+}
+
+// sweepFees 转出全部余额的手续费，不按 NGasPrice 放大：传统交易使用节点建议的 gas price，
+// EIP-1559 交易的 maxFeePerGas 为当前 baseFee 加小费（指定了 MaxFeePerGas 时使用指定值）。
+// 没有指定 MaxPriorityFeePerGas 时小费等于 maxFeePerGas，实际价格就是 maxFeePerGas，手续费是确定的，账户不留余额；
+// 指定了小费时保留指定的值，baseFee 下降时账户会留下少量余额。baseFee 上涨超过 maxFeePerGas 时交易要等它回落才会上链。
+func sweepFees(ctx context.Context, backend Backend, opts FeeOptions) (*TxFees, error) {
+	if opts.Legacy {
+		price, err := backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &TxFees{GasPrice: price}, nil
+	}
+
+	opts.NGasPrice = 1
+	fees, err := SuggestFees(ctx, backend, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxPriorityFeePerGas == nil {
+		fees.GasTipCap = fees.GasFeeCap
+	}
+	return fees, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"geth-cli/jsonrpc"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// poolSeenRetention 交易池首次发现时间的记录保留时间。
+const poolSeenRetention = 7 * 24 * time.Hour
+
+var decodeFlag = &cli.BoolFlag{
+	Name:  "decode",
+	Usage: "show numbers instead of hex, decode ERC-20 transfer/approve/transferFrom calls and how long geth-cli has seen each transaction",
+}
+
+// DecodedPoolTx txpool pending --decode 输出的交易，金额单位为 wei。
+type DecodedPoolTx struct {
+	Hash                 string        `json:"hash"`
+	From                 string        `json:"from"`
+	To                   string        `json:"to"`
+	Nonce                uint64        `json:"nonce"`
+	Type                 uint64        `json:"type"`
+	Gas                  uint64        `json:"gas"`
+	GasPrice             *big.Int      `json:"gasPrice"`
+	MaxFeePerGas         *big.Int      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *big.Int      `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *big.Int      `json:"value"`
+	Call                 *DecodedToken `json:"tokenCall,omitempty"`
+	FirstSeenLocally     time.Time     `json:"firstSeenLocally"`
+	SeenSeconds          uint64        `json:"seenSeconds"`
+}
+
+// MarshalJSON 金额输出为十进制字符串
+func (d *DecodedPoolTx) MarshalJSON() ([]byte, error) {
+	type plain DecodedPoolTx
+	return json.Marshal(&struct {
+		*plain
+		GasPrice             string `json:"gasPrice"`
+		MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+		Value                string `json:"value"`
+	}{
+		plain:                (*plain)(d),
+		GasPrice:             decimalString(d.GasPrice),
+		MaxFeePerGas:         decimalString(d.MaxFeePerGas),
+		MaxPriorityFeePerGas: decimalString(d.MaxPriorityFeePerGas),
+		Value:                decimalString(d.Value),
+	})
+}
+
+// DecodedToken 解码的 ERC-20 调用，From 只有 transferFrom 有，approve 时 To 为被授权的地址。
+type DecodedToken struct {
+	Method string         `json:"method"`
+	Token  common.Address `json:"token"`
+	Symbol string         `json:"symbol,omitempty"`
+	From   string         `json:"from,omitempty"`
+	To     string         `json:"to"`
+	Amount string         `json:"amount,omitempty"`
+	Raw    *big.Int       `json:"raw"`
+}
+
+// MarshalJSON 金额输出为十进制字符串
+func (d *DecodedToken) MarshalJSON() ([]byte, error) {
+	type plain DecodedToken
+	return json.Marshal(&struct {
+		*plain
+		Raw string `json:"raw"`
+	}{plain: (*plain)(d), Raw: decimalString(d.Raw)})
+}
+
+// decodePoolTransactions 把交易池中的十六进制字段转换为数值并解码代币调用。
+// 节点不提供交易进入交易池的时间，等待时间从本地 nonce 日志的发送时间或 geth-cli 第一次看到交易的时间算起。
+func decodePoolTransactions(ctx context.Context, transactions []*jsonrpc.StEthTransaction) ([]*DecodedPoolTx, error) {
+	seen, err := updatePoolSeen(transactions)
+	if err != nil {
+		log.Printf("txpool seen times: %s", err.Error())
+	}
+	sent := sentTimes(ctx, transactions)
+
+	tokens := make(map[common.Address]*TokenInfo)
+	out := []*DecodedPoolTx{}
+	for _, rpcTx := range transactions {
+		d, err := decodePoolTx(rpcTx)
+		if err != nil {
+			return nil, xerrors.Errorf("tx %s: %w", rpcTx.Hash, err)
+		}
+
+		d.FirstSeenLocally = time.Now()
+		if t, ok := seen[strings.ToLower(rpcTx.Hash)]; ok {
+			d.FirstSeenLocally = t
+		}
+		if t, ok := sent[strings.ToLower(rpcTx.Hash)]; ok && t.Before(d.FirstSeenLocally) {
+			d.FirstSeenLocally = t
+		}
+		d.SeenSeconds = uint64(time.Since(d.FirstSeenLocally) / time.Second)
+
+		if rpcTx.Input != "" && rpcTx.To != "" {
+			data, err := hexutil.Decode(rpcTx.Input)
+			if err != nil {
+				return nil, xerrors.Errorf("tx %s: input: %w", rpcTx.Hash, err)
+			}
+			token := common.HexToAddress(rpcTx.To)
+			if d.Call = decodeTokenCall(token, data); d.Call != nil {
+				info, ok := tokens[token]
+				if !ok {
+					info = lookupTokenInfo(token)
+					tokens[token] = info
+				}
+				if info != nil {
+					d.Call.Symbol = info.Symbol
+					d.Call.Amount = formatDecimal(d.Call.Raw, info.Decimals)
+				}
+			}
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func decodePoolTx(rpcTx *jsonrpc.StEthTransaction) (*DecodedPoolTx, error) {
+	d := &DecodedPoolTx{Hash: rpcTx.Hash, From: rpcTx.From, To: rpcTx.To}
+
+	var err error
+	if d.Nonce, err = hexutil.DecodeUint64(rpcTx.Nonce); err != nil {
+		return nil, xerrors.Errorf("nonce: %w", err)
+	}
+	if d.Gas, err = hexutil.DecodeUint64(rpcTx.Gas); err != nil {
+		return nil, xerrors.Errorf("gas: %w", err)
+	}
+	if d.GasPrice, err = hexutil.DecodeBig(rpcTx.GasPrice); err != nil {
+		return nil, xerrors.Errorf("gasPrice: %w", err)
+	}
+	if d.Value, err = hexutil.DecodeBig(rpcTx.Value); err != nil {
+		return nil, xerrors.Errorf("value: %w", err)
+	}
+	if rpcTx.Type != "" {
+		if d.Type, err = hexutil.DecodeUint64(rpcTx.Type); err != nil {
+			return nil, xerrors.Errorf("type: %w", err)
+		}
+	}
+	if rpcTx.MaxFeePerGas != "" {
+		if d.MaxFeePerGas, err = hexutil.DecodeBig(rpcTx.MaxFeePerGas); err != nil {
+			return nil, xerrors.Errorf("maxFeePerGas: %w", err)
+		}
+		if d.MaxPriorityFeePerGas, err = hexutil.DecodeBig(rpcTx.MaxPriorityFeePerGas); err != nil {
+			return nil, xerrors.Errorf("maxPriorityFeePerGas: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// decodeTokenCall 解码 ERC-20 的 transfer、approve、transferFrom 调用，其他调用返回 nil。
+func decodeTokenCall(token common.Address, data []byte) *DecodedToken {
+	if len(data) < 4 {
+		return nil
+	}
+	method, err := tokenABI.MethodById(data[:4])
+	if err != nil {
+		return nil
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil
+	}
+
+	call := &DecodedToken{Method: method.Name, Token: token}
+	switch method.Name {
+	case "transfer", "approve":
+		call.To = args[0].(common.Address).Hex()
+		call.Raw = args[1].(*big.Int)
+	case "transferFrom":
+		call.From = args[0].(common.Address).Hex()
+		call.To = args[1].(common.Address).Hex()
+		call.Raw = args[2].(*big.Int)
+	default:
+		return nil
+	}
+	return call
+}
+
+func (d *DecodedPoolTx) String() string {
+	fees := fmt.Sprintf("gasPrice %s gwei", formatDecimal(d.GasPrice, 9))
+	if d.MaxFeePerGas != nil {
+		fees = fmt.Sprintf("maxFee %s gwei, tip %s gwei", formatDecimal(d.MaxFeePerGas, 9), formatDecimal(d.MaxPriorityFeePerGas, 9))
+	}
+
+	seen := (time.Duration(d.SeenSeconds) * time.Second).String()
+	s := fmt.Sprintf("%s nonce %d -> %s: %s ETH, gas %d, %s, seen for %s\n  %s",
+		d.From, d.Nonce, d.To, formatDecimal(d.Value, 18), d.Gas, fees, seen, d.Hash)
+	if d.Call == nil {
+		return s
+	}
+
+	amount := d.Call.Raw.String()
+	if d.Call.Amount != "" {
+		amount = d.Call.Amount + " " + d.Call.Symbol
+	}
+	switch d.Call.Method {
+	case "approve":
+		s += fmt.Sprintf("\n  approve %s to spend %s", d.Call.To, amount)
+	case "transferFrom":
+		s += fmt.Sprintf("\n  transferFrom %s %s to %s", d.Call.From, amount, d.Call.To)
+	default:
+		s += fmt.Sprintf("\n  transfer %s to %s", amount, d.Call.To)
+	}
+	return s
+}
+
+// updatePoolSeen 记录每笔交易第一次被 geth-cli 列出的时间，返回以小写哈希为键的首次发现时间。
+// 只记录经过 --from 等条件过滤后显示的交易，这个时间不是交易进入交易池的时间。
+func updatePoolSeen(transactions []*jsonrpc.StEthTransaction) (map[string]time.Time, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "geth-cli", "txpool-seen.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	seen := make(map[string]time.Time)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &seen); err != nil {
+			return nil, xerrors.Errorf("%s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	now := time.Now()
+	for hash, t := range seen {
+		if now.Sub(t) > poolSeenRetention {
+			delete(seen, hash)
+		}
+	}
+	for _, rpcTx := range transactions {
+		hash := strings.ToLower(rpcTx.Hash)
+		if _, ok := seen[hash]; !ok {
+			seen[hash] = now
+		}
+	}
+
+	data, err := json.Marshal(seen)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return nil, err
+	}
+	return seen, os.Rename(path+".tmp", path)
+}
+
+// sentTimes 从发送账户的 nonce 日志中查找交易的发送时间，以小写哈希为键。
+func sentTimes(ctx context.Context, transactions []*jsonrpc.StEthTransaction) map[string]time.Time {
+	sent := make(map[string]time.Time)
+
+	var chainID hexutil.Big
+	if err := client.Call(ctx, &chainID, "eth_chainId"); err != nil {
+		return sent
+	}
+
+	read := make(map[string]bool)
+	for _, rpcTx := range transactions {
+		from := strings.ToLower(rpcTx.From)
+		if read[from] {
+			continue
+		}
+		read[from] = true
+
+		j, err := newNonceManager(chainID.ToInt(), common.HexToAddress(from)).read()
+		if err != nil {
+			continue
+		}
+		for _, issued := range j.Issued {
+			if issued.Hash != nil {
+				sent[strings.ToLower(issued.Hash.Hex())] = issued.Time
+			}
+		}
+	}
+	return sent
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"golang.org/x/xerrors"
+)
+
+// newSender 连接节点，构造按节点的 chain id 签名、从 nonce 日志分配 nonce、--dry-run 时只模拟的 payments.Sender。
+func newSender(ctx context.Context, endpoint string, signer payments.Signer, feeOpts payments.FeeOptions) (*payments.Sender, error) {
+	client, err := ethclient.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := signingChainID(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return newClientSender(client, chainID, signer, feeOpts), nil
+}
+
+// newClientSender 同 newSender，使用已经连接的节点和查询过的 chain id，多个账户可以共用一个连接。
+func newClientSender(client *ethclient.Client, chainID *big.Int, signer payments.Signer, feeOpts payments.FeeOptions) *payments.Sender {
+	sender := payments.NewSender(client, signer, chainID)
+	sender.Fees = feeOpts
+	sender.Nonces = journalNonces{chainID: chainID, backend: client}
+	sender.Broadcast = func(ctx context.Context, tx *types.Transaction) error {
+		return sendTransaction(ctx, client, tx)
+	}
+	return sender
+}
+
+// journalNonces 用本地的 nonce 日志实现 payments.NonceSource，见 NonceManager。
+// offline 为 true 时是 tx build 的预留，不会因为超时被重新分配；nonce 不为空时只预留这个 nonce，已被占用时报错。
+type journalNonces struct {
+	chainID *big.Int
+	backend nonceBackend
+	offline bool
+	nonce   *uint64
+}
+
+// --dry-run 时不写入日志，只计算会分配的 nonce。
+func (n journalNonces) Reserve(ctx context.Context, from common.Address) (uint64, error) {
+	m := newNonceManager(n.chainID, from)
+	var min uint64
+	if n.nonce != nil {
+		min = *n.nonce
+	}
+
+	var nonce uint64
+	if dryRun {
+		var err error
+		if nonce, err = m.Peek(ctx, n.backend, min); err != nil {
+			return 0, err
+		}
+	} else {
+		reservation, err := m.reserve(ctx, n.backend, min, n.offline)
+		if err != nil {
+			return 0, err
+		}
+		nonce = reservation.Nonce
+	}
+
+	if n.nonce != nil && nonce != *n.nonce {
+		n.Done(from, nonce, common.Hash{}, errNonceNotUsed)
+		return 0, xerrors.Errorf("nonce %d is already used or reserved, the next free nonce is %d", *n.nonce, nonce)
+	}
+	return nonce, nil
+}
+
+func (n journalNonces) Done(from common.Address, nonce uint64, hash common.Hash, sendErr error) {
+	if dryRun {
+		return
+	}
+	reservation := &NonceReservation{m: newNonceManager(n.chainID, from), Nonce: nonce}
+	reservation.Done(hash, sendErr)
+}
+
+// logBuilt 输出交易使用的手续费和 gas limit。
+func logBuilt(result *payments.Result) {
+	log.Println("gas fees:", result.Fees)
+	log.Println("gas Limit:", result.GasLimit)
+}
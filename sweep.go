@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+var sweepCmd = &cli.Command{
+	Name:  "sweep",
+	Usage: "move the whole token and eth balance of many wallets to one address",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "to",
+			Value:    "",
+			Required: true,
+			Usage:    "the address receiving the funds",
+		},
+		&cli.StringFlag{
+			Name:     "keys",
+			Value:    "",
+			Required: true,
+			Usage:    "a keystore directory (unlocked with --password-file) or a mnemonic file (wallets derived with --path)",
+		},
+		hdRangeFlag,
+		&cli.StringFlag{
+			Name:  "asset",
+			Value: "eth",
+			Usage: "eth, or a token address or alias (bzz) to sweep the token first and then the remaining eth",
+		},
+		tokenGasLimitFlag,
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Value: 30 * time.Minute,
+			Usage: "give up waiting for a wallet's token transfer to be mined after this long",
+		},
+	}, append(feeFlags, passwordFlags...)...),
+	Before: connectNode,
+	Action: func(c *cli.Context) error {
+		if !common.IsHexAddress(c.String("to")) {
+			return xerrors.Errorf("invalid --to address: %s", c.String("to"))
+		}
+		to := common.HexToAddress(c.String("to"))
+
+		var info *TokenInfo
+		if c.String("asset") != "eth" {
+			var err error
+			if _, info, err = dialToken(c.String("asset")); err != nil {
+				return err
+			}
+		}
+
+		wallets, err := loadSweepWallets(c)
+		if err != nil {
+			return err
+		}
+
+		ethClient, err := ethclient.Dial(defaultEndPoint)
+		if err != nil {
+			return err
+		}
+		defer ethClient.Close()
+		chainID, err := signingChainID(context.Background(), ethClient)
+		if err != nil {
+			return err
+		}
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		report := &SweepReport{To: to, Asset: assetSymbol(info), TotalETH: new(big.Int)}
+		if info != nil {
+			report.TotalToken = new(big.Int)
+		}
+		for _, w := range wallets {
+			var r *SweepResult
+			if w.address == to {
+				r = &SweepResult{From: w.address, Source: w.source, Skipped: "the wallet is the --to address"}
+			} else {
+				r = sweepWallet(c, ethClient, chainID, feeOpts, w, to, info, report)
+			}
+			switch {
+			case r.Error != "":
+				report.Failed++
+			case r.TokenTx == nil && r.ETHTx == nil:
+				report.Skipped++
+			default:
+				report.Swept++
+			}
+			report.Wallets = append(report.Wallets, r)
+		}
+
+		if err := printResult(report, func() { printSweepReport(report, info) }); err != nil {
+			return err
+		}
+		if report.Failed > 0 {
+			return xerrors.Errorf("%d of %d wallets failed", report.Failed, len(report.Wallets))
+		}
+		return nil
+	},
+}
+
+// SweepReport sweep 的汇总，金额为最小单位。
+type SweepReport struct {
+	To         common.Address `json:"to"`
+	Asset      string         `json:"asset"`
+	Wallets    []*SweepResult `json:"wallets"`
+	Swept      int            `json:"swept"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	TotalToken *big.Int       `json:"totalToken,omitempty"`
+	TotalETH   *big.Int       `json:"totalEth"`
+}
+
+// SweepResult 一个钱包的转出结果，Source 为 keyfile 或派生路径，没有可转出的余额或钱包就是 --to 时 Skipped 说明原因。
+type SweepResult struct {
+	From    common.Address `json:"from"`
+	Source  string         `json:"source"`
+	Token   *big.Int       `json:"token,omitempty"`
+	TokenTx *common.Hash   `json:"tokenTx,omitempty"`
+	ETH     *big.Int       `json:"eth,omitempty"`
+	Fee     *big.Int       `json:"fee,omitempty"`
+	ETHTx   *common.Hash   `json:"ethTx,omitempty"`
+	Skipped string         `json:"skipped,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// MarshalJSON 金额输出为十进制字符串
+func (r *SweepReport) MarshalJSON() ([]byte, error) {
+	type plain SweepReport
+	return json.Marshal(&struct {
+		*plain
+		TotalToken string `json:"totalToken,omitempty"`
+		TotalETH   string `json:"totalEth"`
+	}{plain: (*plain)(r), TotalToken: decimalString(r.TotalToken), TotalETH: decimalString(r.TotalETH)})
+}
+
+// MarshalJSON 金额输出为十进制字符串
+func (r *SweepResult) MarshalJSON() ([]byte, error) {
+	type plain SweepResult
+	return json.Marshal(&struct {
+		*plain
+		Token string `json:"token,omitempty"`
+		ETH   string `json:"eth,omitempty"`
+		Fee   string `json:"fee,omitempty"`
+	}{plain: (*plain)(r), Token: decimalString(r.Token), ETH: decimalString(r.ETH), Fee: decimalString(r.Fee)})
+}
+
+type sweepSource struct {
+	address common.Address
+	source  string
+	key     *ecdsa.PrivateKey
+}
+
+// loadSweepWallets 解锁 keystore 目录中的所有账户（使用同一个密码），或者从助记词派生 --path 的账户。
+// 在转出任何资金之前加载全部私钥，任何一个无法解锁都直接返回错误。
+func loadSweepWallets(c *cli.Context) ([]*sweepSource, error) {
+	keys := c.String("keys")
+	fi, err := os.Stat(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var wallets []*sweepSource
+	if !fi.IsDir() {
+		derived, err := deriveAccounts(keys, c.String("path"))
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range derived {
+			wallets = append(wallets, &sweepSource{address: account.Address, source: account.Path, key: account.key})
+		}
+		return wallets, nil
+	}
+
+	accounts := openKeystore(keys).Accounts()
+	if len(accounts) == 0 {
+		return nil, xerrors.Errorf("no keyfiles in %s", keys)
+	}
+	passphrase, err := readPassphrase(c, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		keyJSON, err := ioutil.ReadFile(account.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := keystore.DecryptKey(keyJSON, passphrase)
+		if err != nil {
+			return nil, xerrors.Errorf("unlock %s: %w", account.URL.Path, err)
+		}
+		wallets = append(wallets, &sweepSource{address: account.Address, source: account.URL.Path, key: key.PrivateKey})
+	}
+	return wallets, nil
+}
+
+// sweepWallet 先转出全部代币并等待上链，再转出扣除手续费后的全部 ETH，所有钱包共用 ethClient 的连接。
+// --dry-run 时代币交易不会上链，模拟的 ETH 金额没有扣除代币交易的手续费。
+func sweepWallet(c *cli.Context, ethClient *ethclient.Client, chainID *big.Int, feeOpts payments.FeeOptions, w *sweepSource, to common.Address, info *TokenInfo, report *SweepReport) *SweepResult {
+	r := &SweepResult{From: w.address, Source: w.source}
+	ctx := context.Background()
+	sender := newClientSender(ethClient, chainID, payments.NewKeySigner(w.key), feeOpts)
+
+	if info != nil {
+		result, amount, err := sender.SweepToken(ctx, info.Address, to, c.Uint64("gasLimit"))
+		switch {
+		case xerrors.Is(err, payments.ErrNothingToSweep):
+		case err != nil:
+			r.Error = err.Error()
+			return r
+		default:
+			hash := result.Hash()
+			r.Token, r.TokenTx = amount, &hash
+			report.TotalToken.Add(report.TotalToken, amount)
+			log.Printf("%s: %s %s in %s", w.address.Hex(), formatDecimal(amount, info.Decimals), info.Symbol, hash.Hex())
+
+			if !dryRun {
+				waitCtx, cancel := waitContext(c)
+				_, err := WaitForTx(waitCtx, ethClient, result.Tx, 1)
+				cancel()
+				if err != nil {
+					r.Error = err.Error()
+					return r
+				}
+			}
+		}
+	}
+
+	result, amount, err := sender.SweepETH(ctx, to)
+	switch {
+	case xerrors.Is(err, payments.ErrNothingToSweep):
+		r.Skipped = err.Error()
+	case err != nil:
+		r.Error = err.Error()
+	default:
+		hash := result.Hash()
+		r.ETH, r.ETHTx = amount, &hash
+		r.Fee = new(big.Int).Mul(new(big.Int).SetUint64(result.GasLimit), sweepGasPrice(result.Fees))
+		report.TotalETH.Add(report.TotalETH, amount)
+		log.Printf("%s: %s ETH (fee %s ETH) in %s", w.address.Hex(), formatDecimal(amount, 18), formatDecimal(r.Fee, 18), hash.Hex())
+	}
+	return r
+}
+
+// sweepGasPrice SweepETH 交易实际的 gas 价格。
+func sweepGasPrice(fees *payments.TxFees) *big.Int {
+	if fees.GasPrice != nil {
+		return fees.GasPrice
+	}
+	return fees.GasFeeCap
+}
+
+func printSweepReport(report *SweepReport, info *TokenInfo) {
+	for _, r := range report.Wallets {
+		fmt.Printf("%s (%s)\n", r.From.Hex(), r.Source)
+		if r.TokenTx != nil {
+			fmt.Printf("  %s %s in %s\n", formatDecimal(r.Token, info.Decimals), info.Symbol, r.TokenTx.Hex())
+		}
+		if r.ETHTx != nil {
+			fmt.Printf("  %s ETH (fee %s ETH) in %s\n", formatDecimal(r.ETH, 18), formatDecimal(r.Fee, 18), r.ETHTx.Hex())
+		}
+		if r.Skipped != "" {
+			fmt.Printf("  skipped: %s\n", r.Skipped)
+		}
+		if r.Error != "" {
+			fmt.Printf("  failed: %s\n", r.Error)
+		}
+	}
+
+	fmt.Printf("swept %d wallets, skipped %d, failed %d: ", report.Swept, report.Skipped, report.Failed)
+	if info != nil {
+		fmt.Printf("%s %s and ", formatDecimal(report.TotalToken, info.Decimals), info.Symbol)
+	}
+	fmt.Printf("%s ETH to %s\n", formatDecimal(report.TotalETH, 18), report.To.Hex())
+}
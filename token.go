@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"geth-cli/erc20-token"
+	"geth-cli/payments"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// tokenAliases 当前网络配置中代币的别名，由 setupNetwork 设置。
+var tokenAliases = map[string]string{}
+
+// tokenABI ERC-20 合约的 ABI，见 payments.TokenABI。
+var tokenABI = payments.TokenABI
+
+var tokenFlag = &cli.StringFlag{
+	Name:     "token",
+	Value:    "",
+	Required: true,
+	Usage:    "the ERC-20 token contract address or alias (bzz)",
+}
+
+var tokenGasLimitFlag = &cli.Uint64Flag{
+	Name:  "gasLimit",
+	Value: 0,
+	Usage: "the gas limit (default the estimate plus --gasMargin)",
+}
+
+var TokenCmd = &cli.Command{
+	Name:   "token",
+	Usage:  "interact with any ERC-20 token",
+	Before: connectNode,
+	Subcommands: []*cli.Command{
+		tokenInfoCmd,
+		tokenBalanceCmd,
+		tokenSendCmd,
+		tokenApproveCmd,
+		tokenAllowanceCmd,
+		tokenTransferFromCmd,
+		tokenBatchCmd,
+	},
+}
+
+var tokenInfoCmd = &cli.Command{
+	Name:  "info",
+	Usage: "show the name, symbol, decimals and total supply of the token",
+	Flags: []cli.Flag{tokenFlag},
+	Action: func(c *cli.Context) error {
+		_, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+
+		// totalSupply 读取失败时显示为 unknown，而不是 0。
+		totalSupply := "unknown"
+		if info.TotalSupply != nil {
+			totalSupply = formatDecimal(info.TotalSupply, info.Decimals)
+		}
+		result := map[string]interface{}{
+			"address":     info.Address,
+			"name":        info.Name,
+			"symbol":      info.Symbol,
+			"decimals":    info.Decimals,
+			"totalSupply": totalSupply,
+		}
+		return printResult(result, func() {
+			fmt.Printf("address:      %s\n", info.Address.Hex())
+			fmt.Printf("name:         %s\n", info.Name)
+			fmt.Printf("symbol:       %s\n", info.Symbol)
+			fmt.Printf("decimals:     %d\n", info.Decimals)
+			fmt.Printf("total supply: %s %s\n", totalSupply, info.Symbol)
+		})
+	},
+}
+
+var tokenBalanceCmd = &cli.Command{
+	Name: "balance",
+	Flags: []cli.Flag{
+		tokenFlag,
+		&cli.StringFlag{
+			Name:     "address",
+			Value:    "",
+			Required: true,
+			Usage:    "the ethereum address",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		instance, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+
+		address, err := addressFlag(c, "address")
+		if err != nil {
+			return err
+		}
+		bal, err := instance.BalanceOf(&bind.CallOpts{}, address)
+		if err != nil {
+			return err
+		}
+
+		return printResult(newAmountResult(address, info, bal), func() {
+			fmt.Printf("%s %s\n", formatDecimal(bal, info.Decimals), info.Symbol)
+		})
+	},
+}
+
+var tokenSendCmd = &cli.Command{
+	Name:  "send",
+	Usage: "transfer tokens to the receive wallet",
+	Flags: append([]cli.Flag{
+		tokenFlag,
+		&cli.StringFlag{
+			Name:     "toKey",
+			Value:    "",
+			Required: true,
+			Usage:    "the public key of the receive wallet",
+		},
+		&cli.StringFlag{
+			Name:     "amount",
+			Value:    "",
+			Required: true,
+			Usage:    "the amount of token in whole units, optionally with the symbol (e.g. 12.34 or 12.34bzz)",
+		},
+		tokenGasLimitFlag,
+	}, append(append(feeFlags, waitFlags...), keyFlags...)...),
+	Action: func(c *cli.Context) error {
+		_, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+		amount, err := parseAmount(c.String("amount"), tokenUnits(info), strings.ToLower(info.Symbol))
+		if err != nil {
+			return err
+		}
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		signedTx, err := PayToken(defaultEndPoint, signer, info.Address, c.String("toKey"), amount, c.Uint64("gasLimit"), feeOpts)
+		if err != nil {
+			return err
+		}
+		return waitIfRequested(c, signedTx)
+	},
+}
+
+var tokenApproveCmd = &cli.Command{
+	Name:  "approve",
+	Usage: "allow the spender to transfer tokens on behalf of the signing wallet",
+	Flags: append([]cli.Flag{
+		tokenFlag,
+		&cli.StringFlag{
+			Name:     "spender",
+			Value:    "",
+			Required: true,
+			Usage:    "the address allowed to spend the tokens",
+		},
+		&cli.StringFlag{
+			Name:     "amount",
+			Value:    "",
+			Required: true,
+			Usage:    "the allowance in whole units, optionally with the symbol (e.g. 12.34 or 12.34bzz)",
+		},
+		tokenGasLimitFlag,
+	}, append(append(feeFlags, waitFlags...), keyFlags...)...),
+	Action: func(c *cli.Context) error {
+		_, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+		amount, err := parseAmount(c.String("amount"), tokenUnits(info), strings.ToLower(info.Symbol))
+		if err != nil {
+			return err
+		}
+		spender, err := addressFlag(c, "spender")
+		if err != nil {
+			return err
+		}
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+
+		data, err := tokenABI.Pack("approve", spender, amount)
+		if err != nil {
+			return err
+		}
+
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		signedTx, err := transactToken(defaultEndPoint, signer, info.Address, data, c.Uint64("gasLimit"), feeOpts)
+		if err != nil {
+			return err
+		}
+
+		logTxSent("approve", signedTx)
+		return waitIfRequested(c, signedTx)
+	},
+}
+
+var tokenAllowanceCmd = &cli.Command{
+	Name:  "allowance",
+	Usage: "show how many tokens the spender may still transfer from the owner",
+	Flags: []cli.Flag{
+		tokenFlag,
+		&cli.StringFlag{
+			Name:     "owner",
+			Value:    "",
+			Required: true,
+			Usage:    "the address holding the tokens",
+		},
+		&cli.StringFlag{
+			Name:     "spender",
+			Value:    "",
+			Required: true,
+			Usage:    "the address allowed to spend the tokens",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		instance, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+
+		owner, err := addressFlag(c, "owner")
+		if err != nil {
+			return err
+		}
+		spender, err := addressFlag(c, "spender")
+		if err != nil {
+			return err
+		}
+
+		remaining, err := instance.Allowance(&bind.CallOpts{}, owner, spender)
+		if err != nil {
+			return err
+		}
+
+		return printResult(newAmountResult(owner, info, remaining), func() {
+			fmt.Printf("%s %s\n", formatDecimal(remaining, info.Decimals), info.Symbol)
+		})
+	},
+}
+
+var tokenTransferFromCmd = &cli.Command{
+	Name:  "transfer-from",
+	Usage: "transfer approved tokens from the owner to the receive wallet",
+	Flags: append([]cli.Flag{
+		tokenFlag,
+		&cli.StringFlag{
+			Name:     "owner",
+			Value:    "",
+			Required: true,
+			Usage:    "the address holding the tokens",
+		},
+		&cli.StringFlag{
+			Name:     "toKey",
+			Value:    "",
+			Required: true,
+			Usage:    "the public key of the receive wallet",
+		},
+		&cli.StringFlag{
+			Name:     "amount",
+			Value:    "",
+			Required: true,
+			Usage:    "the amount of token in whole units, optionally with the symbol (e.g. 12.34 or 12.34bzz)",
+		},
+		tokenGasLimitFlag,
+	}, append(append(feeFlags, waitFlags...), keyFlags...)...),
+	Action: func(c *cli.Context) error {
+		_, info, err := dialToken(c.String("token"))
+		if err != nil {
+			return err
+		}
+		amount, err := parseAmount(c.String("amount"), tokenUnits(info), strings.ToLower(info.Symbol))
+		if err != nil {
+			return err
+		}
+		owner, err := addressFlag(c, "owner")
+		if err != nil {
+			return err
+		}
+		receiver, err := addressFlag(c, "toKey")
+		if err != nil {
+			return err
+		}
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+
+		data, err := tokenABI.Pack("transferFrom", owner, receiver, amount)
+		if err != nil {
+			return err
+		}
+
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		signedTx, err := transactToken(defaultEndPoint, signer, info.Address, data, c.Uint64("gasLimit"), feeOpts)
+		if err != nil {
+			return err
+		}
+
+		logTxSent("transferFrom", signedTx)
+		return waitIfRequested(c, signedTx)
+	},
+}
+
+// TokenInfo 代币合约的元数据。
+type TokenInfo struct {
+	Address     common.Address
+	Name        string
+	Symbol      string
+	Decimals    uint8
+	TotalSupply *big.Int
+}
+
+// addressFlag 读取地址参数，拒绝不是 40 位十六进制的地址，避免把代币转到无法找回的地址。
+func addressFlag(c *cli.Context, name string) (common.Address, error) {
+	if !common.IsHexAddress(c.String(name)) {
+		return common.Address{}, xerrors.Errorf("invalid --%s address: %q", name, c.String(name))
+	}
+	return common.HexToAddress(c.String(name)), nil
+}
+
+// resolveToken 把代币别名或地址解析为合约地址。
+func resolveToken(tokenOrAlias string) (common.Address, error) {
+	if address, ok := tokenAliases[strings.ToLower(tokenOrAlias)]; ok {
+		return common.HexToAddress(address), nil
+	}
+	if !common.IsHexAddress(tokenOrAlias) {
+		return common.Address{}, xerrors.Errorf("unknown token: %s", tokenOrAlias)
+	}
+	return common.HexToAddress(tokenOrAlias), nil
+}
+
+// tokenUnits 代币金额允许的单位：代币符号以及指向该代币的别名。
+func tokenUnits(info *TokenInfo) map[string]uint8 {
+	units := map[string]uint8{strings.ToLower(info.Symbol): info.Decimals}
+	for alias, address := range tokenAliases {
+		if common.HexToAddress(address) == info.Address {
+			units[alias] = info.Decimals
+		}
+	}
+	return units
+}
+
+// dialToken 连接节点并读取代币的元数据。
+func dialToken(tokenOrAlias string) (*token.Token, *TokenInfo, error) {
+	tokenAddress, err := resolveToken(tokenOrAlias)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ethclient.Dial(defaultEndPoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instance, err := token.NewToken(tokenAddress, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := LoadTokenInfo(client, tokenAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	return instance, info, nil
+}
+
+// unknownTokenSymbol 合约没有可读的 symbol 时使用的符号，金额仍然可以不带单位或以 token 为单位。
+const unknownTokenSymbol = "TOKEN"
+
+// LoadTokenInfo 读取代币的元数据，只有换算金额需要的 decimals 是必需的。
+// name、symbol、totalSupply 尽量读取：返回 bytes32 的旧合约（如 MKR）也能识别，读取失败时留空。
+func LoadTokenInfo(caller bind.ContractCaller, tokenAddress common.Address) (*TokenInfo, error) {
+	instance, err := token.NewTokenCaller(tokenAddress, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{}
+	info := &TokenInfo{Address: tokenAddress}
+	if info.Decimals, err = instance.Decimals(opts); err != nil {
+		return nil, xerrors.Errorf("token %s decimals: %w", tokenAddress.Hex(), err)
+	}
+	if info.TotalSupply, err = instance.TotalSupply(opts); err != nil {
+		info.TotalSupply = nil
+	}
+	info.Name = tokenText(caller, tokenAddress, "name")
+	if info.Symbol = tokenText(caller, tokenAddress, "symbol"); info.Symbol == "" {
+		info.Symbol = unknownTokenSymbol
+	}
+	return info, nil
+}
+
+// tokenText 读取 name 或 symbol，兼容返回 string 和 bytes32 的合约，失败时返回空字符串。
+func tokenText(caller bind.ContractCaller, tokenAddress common.Address, method string) string {
+	data, err := tokenABI.Pack(method)
+	if err != nil {
+		return ""
+	}
+	out, err := caller.CallContract(context.Background(), ethereum.CallMsg{To: &tokenAddress, Data: data}, nil)
+	if err != nil {
+		return ""
+	}
+
+	// ABI 编码的 string 至少 64 字节，刚好 32 字节的返回值是 bytes32。
+	if len(out) == 32 {
+		return strings.TrimSpace(string(bytes.TrimRight(out, "\x00")))
+	}
+	values, err := tokenABI.Unpack(method, out)
+	if err != nil || len(values) == 0 {
+		return ""
+	}
+	text, _ := values[0].(string)
+	return strings.TrimSpace(text)
+}
+
+// PayToken 调用代币合约的 transfer 方法，金额为代币的最小单位，返回已发送的交易。
+func PayToken(endpoint string, signer payments.Signer, tokenAddress common.Address, toKey string, amount *big.Int, gasLimit uint64, feeOpts payments.FeeOptions) (*types.Transaction, error) {
+	if !common.IsHexAddress(toKey) {
+		return nil, xerrors.Errorf("invalid receiver address: %q", toKey)
+	}
+
+	data, err := tokenABI.Pack("transfer", common.HexToAddress(toKey), amount)
+	if err != nil {
+		return nil, err
+	}
+
+	signedTx, err := transactToken(endpoint, signer, tokenAddress, data, gasLimit, feeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	logTxSent("token", signedTx)
+	return signedTx, nil
+}
+
+// transactToken 签名并发送一笔调用代币合约的交易，data 为编码后的方法调用。
+// gas 以发送者的身份估算，gasLimit 为 0 时使用估算值加 --gasMargin。
+func transactToken(endpoint string, signer payments.Signer, tokenAddress common.Address, data []byte, gasLimit uint64, feeOpts payments.FeeOptions) (*types.Transaction, error) {
+	ctx := context.Background()
+	sender, err := newSender(ctx, endpoint, signer, feeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 代币传输不需要传输ETH，因此将交易“值”设置为“0”。
+	result, err := sender.Transact(ctx, tokenAddress, big.NewInt(0), data, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	logBuilt(result)
+	return result.Tx, nil
+}
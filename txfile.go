@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"geth-cli/payments"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// txFileVersion 交易文件格式的版本，格式变化时递增，旧版本的工具会拒绝读取新版本的文件。
+const txFileVersion = 1
+
+// UnsignedTx tx build 生成、tx sign 读取的未签名交易，数值和 JSON-RPC 一样使用 0x 开头的十六进制。
+// GasPrice 不为空时为传统交易，否则为 EIP-1559 交易。
+type UnsignedTx struct {
+	Version              int              `json:"version"`
+	ChainID              *hexutil.Big     `json:"chainId"`
+	From                 common.Address   `json:"from"`
+	To                   common.Address   `json:"to"`
+	Nonce                hexutil.Uint64   `json:"nonce"`
+	Gas                  hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big     `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big     `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big     `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big     `json:"value"`
+	Data                 hexutil.Bytes    `json:"data"`
+	Token                *UnsignedTxToken `json:"token,omitempty"`
+}
+
+// UnsignedTxToken 代币转账时附带的代币信息，离线签名时用来按代币单位显示金额。
+type UnsignedTxToken struct {
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+}
+
+// SignedTx tx sign 生成、tx broadcast 读取的已签名交易。
+type SignedTx struct {
+	Version int            `json:"version"`
+	From    common.Address `json:"from"`
+	Hash    common.Hash    `json:"hash"`
+	Raw     hexutil.Bytes  `json:"raw"`
+}
+
+// Tx 按文件内容构造未签名的交易。
+func (u *UnsignedTx) Tx() (*types.Transaction, error) {
+	if u.Version != txFileVersion {
+		return nil, xerrors.Errorf("unsupported transaction file version %d, expected %d", u.Version, txFileVersion)
+	}
+	if u.ChainID == nil || u.ChainID.ToInt().Sign() <= 0 {
+		return nil, xerrors.New("transaction file has no chainId")
+	}
+	if u.Value == nil {
+		u.Value = new(hexutil.Big)
+	}
+
+	fees := &payments.TxFees{}
+	switch {
+	case u.GasPrice != nil:
+		fees.GasPrice = u.GasPrice.ToInt()
+	case u.MaxFeePerGas != nil && u.MaxPriorityFeePerGas != nil:
+		fees.GasFeeCap, fees.GasTipCap = u.MaxFeePerGas.ToInt(), u.MaxPriorityFeePerGas.ToInt()
+	default:
+		return nil, xerrors.New("transaction file needs gasPrice or maxFeePerGas and maxPriorityFeePerGas")
+	}
+
+	return fees.NewTx(u.ChainID.ToInt(), uint64(u.Nonce), u.To, u.Value.ToInt(), uint64(u.Gas), u.Data), nil
+}
+
+// tokenInfo 返回文件中附带的代币信息，没有时返回 nil。
+func (u *UnsignedTx) tokenInfo() *TokenInfo {
+	if u.Token == nil {
+		return nil
+	}
+	return &TokenInfo{Address: u.To, Symbol: u.Token.Symbol, Decimals: u.Token.Decimals}
+}
+
+func newUnsignedTx(from common.Address, chainID *big.Int, tx *types.Transaction) *UnsignedTx {
+	u := &UnsignedTx{
+		Version: txFileVersion,
+		ChainID: (*hexutil.Big)(chainID),
+		From:    from,
+		To:      *tx.To(),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   (*hexutil.Big)(tx.Value()),
+		Data:    tx.Data(),
+	}
+	if tx.Type() == types.LegacyTxType {
+		u.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	} else {
+		u.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		u.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	}
+	return u
+}
+
+var outFlag = &cli.StringFlag{
+	Name:  "out",
+	Value: "",
+	Usage: "write the transaction file here instead of stdout",
+}
+
+var txBuildCmd = &cli.Command{
+	Name:  "build",
+	Usage: "build an unsigned eth or token transfer online (nonce, fees, gas) for tx sign",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Value:    "",
+			Required: true,
+			Usage:    "the address that will sign the transaction",
+		},
+		&cli.StringFlag{
+			Name:     "toKey",
+			Value:    "",
+			Required: true,
+			Usage:    "the receiver address",
+		},
+		&cli.StringFlag{
+			Name:     "amount",
+			Value:    "",
+			Required: true,
+			Usage:    "the amount with a unit (e.g. 1.5eth, or 12.34bzz with --token)",
+		},
+		&cli.StringFlag{
+			Name:  "token",
+			Value: "",
+			Usage: "build an ERC-20 transfer of this token contract address or alias (bzz) instead of an eth transfer",
+		},
+		&cli.StringFlag{
+			Name:  "data",
+			Value: "",
+			Usage: "hex call data for an eth transaction",
+		},
+		&cli.Int64Flag{
+			Name:  "nonce",
+			Value: -1,
+			Usage: "the nonce to use, fails if it is already used or reserved (default the pending nonce of --from)",
+		},
+		&cli.Uint64Flag{
+			Name:  "gasLimit",
+			Value: 0,
+			Usage: "the gas limit (default the estimate plus --gasMargin)",
+		},
+		outFlag,
+	}, feeFlags...),
+	Before: connectNode,
+	Action: func(c *cli.Context) error {
+		if !common.IsHexAddress(c.String("from")) || !common.IsHexAddress(c.String("toKey")) {
+			return xerrors.New("--from and --toKey must be addresses")
+		}
+		from := common.HexToAddress(c.String("from"))
+		to := common.HexToAddress(c.String("toKey"))
+
+		var info *TokenInfo
+		value, data := new(big.Int), []byte(nil)
+		if c.String("token") != "" {
+			if c.String("data") != "" {
+				return xerrors.New("--data cannot be used with --token")
+			}
+
+			var err error
+			if _, info, err = dialToken(c.String("token")); err != nil {
+				return err
+			}
+			amount, err := parseAmount(c.String("amount"), tokenUnits(info), "")
+			if err != nil {
+				return err
+			}
+			if data, err = tokenABI.Pack("transfer", to, amount); err != nil {
+				return err
+			}
+			to = info.Address
+		} else {
+			var err error
+			if value, err = parseAmount(c.String("amount"), ethUnits, ""); err != nil {
+				return err
+			}
+			if c.String("data") != "" {
+				if data, err = hexutil.Decode(c.String("data")); err != nil {
+					return xerrors.Errorf("--data: %w", err)
+				}
+			}
+		}
+
+		client, err := ethclient.Dial(defaultEndPoint)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+
+		chainID, err := signingChainID(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		nonces := journalNonces{chainID: chainID, backend: client, offline: true}
+		if c.Int64("nonce") >= 0 {
+			nonce := uint64(c.Int64("nonce"))
+			nonces.nonce = &nonce
+		}
+
+		// 只构造交易，不需要 Signer
+		sender := &payments.Sender{
+			Backend: client,
+			From:    from,
+			ChainID: chainID,
+			Fees:    feeOpts,
+			Nonces:  nonces,
+		}
+		unsigned, err := sender.Build(ctx, to, value, data, c.Uint64("gasLimit"))
+		if err != nil {
+			return err
+		}
+		logBuilt(&unsigned.Result)
+
+		// 分配的 nonce 保留到 tx broadcast 记录交易哈希或节点拒绝交易，放弃这笔交易时用 nonce reset 清除；
+		// --dry-run 时不预留。
+		u := newUnsignedTx(from, chainID, unsigned.Tx)
+		if info != nil {
+			u.Token = &UnsignedTxToken{Symbol: info.Symbol, Decimals: info.Decimals}
+		}
+
+		if err := writeTxFile(c.String("out"), u); err != nil {
+			unsigned.Done(common.Hash{}, err)
+			return err
+		}
+		return nil
+	},
+}
+
+var txSignCmd = &cli.Command{
+	Name:      "sign",
+	Usage:     "sign a tx build file offline, without connecting to a node",
+	ArgsUsage: "<unsigned.json>",
+	Flags:     append([]cli.Flag{outFlag}, keyFlags...),
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return xerrors.New("expected the unsigned transaction file")
+		}
+
+		var u UnsignedTx
+		if err := readTxFile(c.Args().First(), &u); err != nil {
+			return err
+		}
+		tx, err := u.Tx()
+		if err != nil {
+			return err
+		}
+
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
+		}
+		from := signer.Address()
+		if from != u.From {
+			return xerrors.Errorf("the transaction is from %s but the key is %s", u.From.Hex(), from.Hex())
+		}
+
+		fmt.Fprintln(os.Stderr, "signing:")
+		printTxIntentTo(os.Stderr, from, u.ChainID.ToInt(), tx, u.tokenInfo())
+
+		signedTx, err := signer.SignTx(context.Background(), tx, u.ChainID.ToInt())
+		if err != nil {
+			return err
+		}
+		raw, err := signedTx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		return writeTxFile(c.String("out"), &SignedTx{
+			Version: txFileVersion,
+			From:    from,
+			Hash:    signedTx.Hash(),
+			Raw:     raw,
+		})
+	},
+}
+
+var txBroadcastCmd = &cli.Command{
+	Name:      "broadcast",
+	Usage:     "send a signed transaction from tx sign (or a raw 0x hex transaction)",
+	ArgsUsage: "<signed.json | 0x...>",
+	Flags:     waitFlags,
+	Before:    connectNode,
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return xerrors.New("expected the signed transaction file or raw hex")
+		}
+
+		raw, err := readSignedTx(c.Args().First())
+		if err != nil {
+			return err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return xerrors.Errorf("decode transaction: %w", err)
+		}
+
+		etchClient, err := ethclient.Dial(defaultEndPoint)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+
+		if tx.Protected() {
+			chainID, err := signingChainID(ctx, etchClient)
+			if err != nil {
+				return err
+			}
+			if tx.ChainId().Cmp(chainID) != 0 {
+				return xerrors.Errorf("the transaction is signed for chain id %s but the endpoint is on %s: %w", tx.ChainId(), chainID, ErrChainIDMismatch)
+			}
+		}
+
+		if dryRun {
+			if err := simulateTx(ctx, etchClient, tx); err != nil {
+				return err
+			}
+		} else {
+			_, sendErr := client.EthRpcSendRawTransaction(ctx, hexutil.Encode(raw))
+			if alreadyKnown(sendErr) {
+				log.Printf("the node already has %s", tx.Hash().Hex())
+				sendErr = nil
+			}
+			if err := recordBroadcast(ctx, etchClient, tx, sendErr); err != nil {
+				log.Printf("nonce journal: %s", err.Error())
+			}
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+
+		logTxSent("raw", tx)
+		return waitIfRequested(c, tx)
+	},
+}
+
+// recordBroadcast 把广播的交易记录到发送账户的 nonce 日志，替换 tx build 预留的 nonce。
+// 只有节点明确拒绝交易时才释放预留的 nonce；nonce too low（nonce 已经上链）和连不上节点时交易可能已经发出，保留预留。
+func recordBroadcast(ctx context.Context, client *ethclient.Client, tx *types.Transaction, sendErr error) error {
+	if sendErr != nil && !txRejected(sendErr) {
+		return nil
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	m := newNonceManager(chainID, from)
+	if sendErr != nil {
+		return m.Release(tx.Nonce())
+	}
+	return m.Record(tx.Nonce(), tx.Hash())
+}
+
+// alreadyKnown 节点的交易池中已经有这笔交易。
+func alreadyKnown(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// txRejected 节点返回了 JSON-RPC 错误，说明交易没有进入交易池（不包括 nonce too low 和方法不存在）。
+func txRejected(err error) bool {
+	var rpcErr interface{ ErrorCode() int }
+	if !xerrors.As(err, &rpcErr) {
+		return false
+	}
+	err = payments.ClassifyError(err)
+	return !xerrors.Is(err, payments.ErrNonceTooLow) && !xerrors.Is(err, payments.ErrRPCUnavailable)
+}
+
+// readSignedTx 读取 tx sign 生成的文件，也接受直接传入或写在文件中的 0x 原始交易。
+func readSignedTx(arg string) ([]byte, error) {
+	if strings.HasPrefix(arg, "0x") {
+		return hexutil.Decode(arg)
+	}
+
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	if text := strings.TrimSpace(string(data)); strings.HasPrefix(text, "0x") {
+		return hexutil.Decode(text)
+	}
+
+	var s SignedTx
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, xerrors.Errorf("%s: %w", arg, err)
+	}
+	if s.Version != txFileVersion {
+		return nil, xerrors.Errorf("%s: unsupported transaction file version %d, expected %d", arg, s.Version, txFileVersion)
+	}
+	if len(s.Raw) == 0 {
+		return nil, xerrors.Errorf("%s: no raw transaction", arg)
+	}
+	return s.Raw, nil
+}
+
+func readTxFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return xerrors.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeTxFile 把交易写入 path，path 为空时输出到 stdout。文件总是 JSON 格式，--output 只影响 stdout。
+func writeTxFile(path string, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+
+	if path == "" {
+		return printResult(v, func() {
+			os.Stdout.Write(out)
+		})
+	}
+	if err := ioutil.WriteFile(path, out, 0600); err != nil {
+		return err
+	}
+	return printResult(v, nil)
+}
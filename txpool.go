@@ -5,29 +5,218 @@ import (
 	"encoding/json"
 	"fmt"
 	"geth-cli/jsonrpc"
+	"geth-cli/payments"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 	"log"
+	"math"
 	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var txPoolCmd = &cli.Command{
-	Name: "txpool",
+	Name:   "txpool",
+	Before: connectNode,
 	Subcommands: []*cli.Command{
+		statusCmd,
+		inspectCmd,
 		pendingCmd,
+		queuedCmd,
 		replaceCmd,
+		cancelCmd,
+		fillGapsCmd,
 	},
 }
 
 var pendingCmd = &cli.Command{
-	Name: "pending",
+	Name:  "pending",
+	Usage: "list pending transactions, which can be mined in the next block",
+	Flags: append([]cli.Flag{decodeFlag}, poolFilterFlags...),
+	Action: func(c *cli.Context) error {
+		return listPoolTransactions(c, "pending")
+	},
+}
+
+var queuedCmd = &cli.Command{
+	Name:  "queued",
+	Usage: "list queued transactions, which wait for a missing lower nonce",
+	Flags: append([]cli.Flag{decodeFlag}, poolFilterFlags...),
+	Action: func(c *cli.Context) error {
+		return listPoolTransactions(c, "queued")
+	},
+}
+
+var poolFilterFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "from",
+		Value: "",
+		Usage: "filters the specified wallet address",
+	},
+	&cli.StringFlag{
+		Name:  "to",
+		Value: "",
+		Usage: "filters the specified receiver or contract address",
+	},
+	&cli.StringFlag{
+		Name:  "min-gas-price",
+		Value: "",
+		Usage: "only transactions paying at least this gas price (max fee per gas for EIP-1559), e.g. 20gwei (default unit gwei)",
+	},
+	&cli.StringFlag{
+		Name:  "nonce-range",
+		Value: "",
+		Usage: "only these nonces: 42, 40-50, 40- or -50",
+	},
+}
+
+// listPoolTransactions 按 poolFilterFlags 过滤交易池 section 中的交易，按地址和 nonce 排序输出。
+func listPoolTransactions(c *cli.Context, section string) error {
+	filter, err := poolFilterFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := poolTransactions(section, c.String("from"))
+	if err != nil {
+		return err
+	}
+
+	var out []*jsonrpc.StEthTransaction
+	for _, v := range transactions {
+		if filter.match(v) {
+			out = append(out, v)
+		}
+	}
+	sortByNonce(out)
+
+	if c.Bool("decode") {
+		decoded, err := decodePoolTransactions(context.Background(), out)
+		if err != nil {
+			return err
+		}
+		return printResult(decoded, func() {
+			for _, d := range decoded {
+				fmt.Println(d)
+			}
+		})
+	}
+
+	if out == nil && outputFormat == "text" {
+		return nil
+	}
+	if out == nil {
+		out = []*jsonrpc.StEthTransaction{}
+	}
+
+	return printResult(out, func() {
+		bytes, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(bytes))
+	})
+}
+
+// poolFilter 交易池交易的过滤条件，from 在 poolTransactions 中按地址过滤。
+type poolFilter struct {
+	to          string
+	minGasPrice *big.Int
+	minNonce    uint64
+	maxNonce    uint64
+}
+
+func poolFilterFromContext(c *cli.Context) (*poolFilter, error) {
+	f := &poolFilter{to: c.String("to"), maxNonce: math.MaxUint64}
+	if f.to != "" && !common.IsHexAddress(f.to) {
+		return nil, xerrors.Errorf("--to: invalid address %s", f.to)
+	}
+
+	if s := c.String("min-gas-price"); s != "" {
+		price, err := parseAmount(s, ethUnits, "gwei")
+		if err != nil {
+			return nil, xerrors.Errorf("--min-gas-price: %w", err)
+		}
+		f.minGasPrice = price
+	}
+
+	if s := c.String("nonce-range"); s != "" {
+		var err error
+		if f.minNonce, f.maxNonce, err = parseNonceRange(s); err != nil {
+			return nil, xerrors.Errorf("--nonce-range: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func (f *poolFilter) match(rpcTx *jsonrpc.StEthTransaction) bool {
+	if f.to != "" && !strings.EqualFold(rpcTx.To, f.to) {
+		return false
+	}
+
+	if f.minGasPrice != nil {
+		price := rpcTx.GasPrice
+		if rpcTx.MaxFeePerGas != "" {
+			price = rpcTx.MaxFeePerGas
+		}
+		gasPrice, err := hexutil.DecodeBig(price)
+		if err != nil || gasPrice.Cmp(f.minGasPrice) < 0 {
+			return false
+		}
+	}
+
+	nonce, err := hexutil.DecodeUint64(rpcTx.Nonce)
+	if err != nil {
+		return false
+	}
+	return nonce >= f.minNonce && nonce <= f.maxNonce
+}
+
+// parseNonceRange 解析 "42"、"40-50"、"40-" 或 "-50"，两端都包含在范围内。
+func parseNonceRange(s string) (uint64, uint64, error) {
+	lo, hi := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		lo, hi = s[:i], s[i+1:]
+	}
+
+	min, max := uint64(0), uint64(math.MaxUint64)
+	var err error
+	if lo = strings.TrimSpace(lo); lo != "" {
+		if min, err = strconv.ParseUint(lo, 10, 64); err != nil {
+			return 0, 0, xerrors.Errorf("invalid nonce %q", lo)
+		}
+	}
+	if hi = strings.TrimSpace(hi); hi != "" {
+		if max, err = strconv.ParseUint(hi, 10, 64); err != nil {
+			return 0, 0, xerrors.Errorf("invalid nonce %q", hi)
+		}
+	}
+	if min > max {
+		return 0, 0, xerrors.Errorf("empty range %s", s)
+	}
+	return min, max, nil
+}
+
+var statusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "show the number of pending and queued transactions",
+	Action: func(c *cli.Context) error {
+		status, err := client.TxPoolStatus(context.Background())
+		if err != nil {
+			return xerrors.Errorf("txpool: %w", err)
+		}
+		return printResult(status, func() {
+			fmt.Printf("pending: %d\n", status.Pending)
+			fmt.Printf("queued:  %d\n", status.Queued)
+		})
+	},
+}
+
+var inspectCmd = &cli.Command{
+	Name:  "inspect",
+	Usage: "summarize the pending and queued transactions of each account",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "from",
@@ -36,182 +225,544 @@ var pendingCmd = &cli.Command{
 		},
 	},
 	Action: func(c *cli.Context) error {
-		transactions, err := client.TxPoolContent()
+		inspect, err := client.TxPoolInspect(context.Background())
 		if err != nil {
-			log.Fatal("txpool:", err)
+			return xerrors.Errorf("txpool: %w", err)
 		}
 
-		filter := c.String("from")
-		pending := transactions["pending"]
+		accounts := poolAccounts(inspect, c.String("from"))
+		return printResult(accounts, func() {
+			for _, a := range accounts {
+				fmt.Printf("%s\tpending %s\tqueued %s\n", a.Address, a.Pending.summary(), a.Queued.summary())
+				for _, e := range a.Pending {
+					fmt.Printf("  pending %d: %s\n", e.Nonce, e.Summary)
+				}
+				for _, e := range a.Queued {
+					fmt.Printf("  queued  %d: %s\n", e.Nonce, e.Summary)
+				}
+			}
+		})
+	},
+}
+
+// PoolAccount txpool inspect 中一个地址的交易摘要。
+type PoolAccount struct {
+	Address string      `json:"address"`
+	Pending PoolEntries `json:"pending"`
+	Queued  PoolEntries `json:"queued"`
+}
+
+// PoolEntry 一笔交易的摘要，格式为 "收款地址: 金额 + gas × 价格"。
+type PoolEntry struct {
+	Nonce   uint64 `json:"nonce"`
+	Summary string `json:"summary"`
+}
+
+type PoolEntries []*PoolEntry
+
+// summary 返回交易数和 nonce 范围，例如 "3 (nonce 5-7)"。
+func (entries PoolEntries) summary() string {
+	switch len(entries) {
+	case 0:
+		return "0"
+	case 1:
+		return fmt.Sprintf("1 (nonce %d)", entries[0].Nonce)
+	}
+	return fmt.Sprintf("%d (nonce %d-%d)", len(entries), entries[0].Nonce, entries[len(entries)-1].Nonce)
+}
 
-		var out []*jsonrpc.StEthTransaction
-		for _, pv := range pending {
-			for _, v := range pv {
-				if filter != "" && filter != v.From {
+// poolAccounts 按地址合并 txpool_inspect 的 pending 和 queued，地址和 nonce 有序。
+func poolAccounts(inspect map[string]map[string]map[string]string, from string) []*PoolAccount {
+	byAddress := make(map[string]*PoolAccount)
+	var accounts []*PoolAccount
+	for _, section := range []string{"pending", "queued"} {
+		for address, txs := range inspect[section] {
+			if from != "" && !strings.EqualFold(address, from) {
+				continue
+			}
+			a := byAddress[strings.ToLower(address)]
+			if a == nil {
+				a = &PoolAccount{Address: address, Pending: PoolEntries{}, Queued: PoolEntries{}}
+				byAddress[strings.ToLower(address)] = a
+				accounts = append(accounts, a)
+			}
+
+			var entries PoolEntries
+			for nonce, summary := range txs {
+				n, err := strconv.ParseUint(nonce, 10, 64)
+				if err != nil {
 					continue
 				}
-				out = append(out, v)
+				entries = append(entries, &PoolEntry{Nonce: n, Summary: summary})
 			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Nonce < entries[j].Nonce })
+			if section == "pending" {
+				a.Pending = append(a.Pending, entries...)
+			} else {
+				a.Queued = append(a.Queued, entries...)
+			}
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return strings.ToLower(accounts[i].Address) < strings.ToLower(accounts[j].Address)
+	})
+	if accounts == nil {
+		accounts = []*PoolAccount{}
+	}
+	return accounts
+}
+
+var fillGapsCmd = &cli.Command{
+	Name:  "fill-gaps",
+	Usage: "send 0-value transfers to self for the missing nonces that keep queued transactions from being mined",
+	Flags: append(append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Value: "",
+			Usage: "the wallet address whose gaps are filled (default: the address of the signing key)",
+		},
+		&cli.Uint64Flag{
+			Name:  "gasLimit",
+			Value: 21000, // in units
+			Usage: "the gas limit of the self transfers",
+		},
+	}, feeFlags...), keyFlags...),
+	Action: func(c *cli.Context) error {
+		signer, err := loadSigner(c)
+		if err != nil {
+			return err
 		}
 
-		if out == nil {
-			return nil
+		from := signer.Address()
+		if c.String("from") != "" && !strings.EqualFold(c.String("from"), from.Hex()) {
+			return xerrors.Errorf("the signing key belongs to %s, not %s", from.Hex(), c.String("from"))
 		}
 
-		bytes, _ := json.MarshalIndent(out, "", "  ")
-		fmt.Println(string(bytes))
-		return nil
+		queued, err := poolTransactions("queued", from.Hex())
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		sender, err := newSender(ctx, defaultEndPoint, signer, feeOpts)
+		if err != nil {
+			return err
+		}
+
+		pendingNonce, err := sender.Backend.PendingNonceAt(ctx, from)
+		if err != nil {
+			return err
+		}
+
+		gaps, err := queuedNonceGaps(pendingNonce, queued)
+		if err != nil {
+			return err
+		}
+		if len(gaps) == 0 {
+			log.Printf("no gaps below the queued transactions of %s (pending nonce %d)", from.Hex(), pendingNonce)
+			return printReplaceResults(nil, false)
+		}
+		log.Printf("pending nonce %d, %d queued transactions, filling nonces %s", pendingNonce, len(queued), formatNonces(gaps))
+
+		var results []*ReplaceResult
+		for _, nonce := range gaps {
+			result, err := sender.Cancel(ctx, nonce, nil, payments.ReplaceOptions{GasLimit: c.Uint64("gasLimit")})
+			results = append(results, newReplaceResult("fill", nonce, result, err))
+		}
+		return printReplaceResults(results, true)
 	},
 }
 
+// queuedNonceGaps 返回从 pendingNonce 到最大的 queued nonce 之间交易池里没有的 nonce，
+// 这些 nonce 补上之后 queued 交易才能进入 pending。
+func queuedNonceGaps(pendingNonce uint64, queued []*jsonrpc.StEthTransaction) ([]uint64, error) {
+	present := make(map[uint64]bool)
+	var top uint64
+	for _, rpcTx := range queued {
+		nonce, err := hexutil.DecodeUint64(rpcTx.Nonce)
+		if err != nil {
+			return nil, xerrors.Errorf("error nonce: %s", rpcTx.Nonce)
+		}
+		present[nonce] = true
+		if nonce+1 > top {
+			top = nonce + 1
+		}
+	}
+
+	var gaps []uint64
+	for nonce := pendingNonce; nonce < top; nonce++ {
+		if !present[nonce] {
+			gaps = append(gaps, nonce)
+		}
+	}
+	return gaps, nil
+}
+
+// sortByNonce 按地址和 nonce 排序交易池中的交易。
+func sortByNonce(transactions []*jsonrpc.StEthTransaction) {
+	sort.SliceStable(transactions, func(i, j int) bool {
+		a, b := transactions[i], transactions[j]
+		if !strings.EqualFold(a.From, b.From) {
+			return strings.ToLower(a.From) < strings.ToLower(b.From)
+		}
+		an, _ := hexutil.DecodeUint64(a.Nonce)
+		bn, _ := hexutil.DecodeUint64(b.Nonce)
+		return an < bn
+	})
+}
+
 var replaceCmd = &cli.Command{
 	Name: "replace",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:     "from",
-			Value:    "",
-			Required: true,
-			Usage:    "filters the specified wallet address",
-		},
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
-			Name:     "fromKey",
-			Value:    "",
-			Required: true,
-			Usage:    "the private key for the replace messages",
+			Name:  "from",
+			Value: "",
+			Usage: "the wallet address whose transactions are replaced, must be the signing key's (default: the address of the signing key)",
 		},
 		&cli.Uint64Flag{
 			Name:  "nGasPrice",
 			Value: 2, // in units
-			Usage: "the amount of gas price (wei)",
+			Usage: "n times of the current gas price (legacy) or base fee (EIP-1559)",
+		},
+		&cli.Uint64Flag{
+			Name:  "bump",
+			Value: 10,
+			Usage: "the minimum fee bump over the pending transaction (percent)",
 		},
 		&cli.Uint64Flag{
 			Name:  "gasLimit",
 			Value: 0, // in units
 			Usage: "the amount of gas limit (wei)",
 		},
-	},
+	}, keyFlags...),
 	Action: func(c *cli.Context) error {
-		allTransactions, err := client.TxPoolContent()
+		signer, err := loadSigner(c)
 		if err != nil {
-			log.Fatal("txpool:", err)
+			return err
 		}
 
-		filter := c.String("from")
-		pending := allTransactions["pending"]
+		from := signer.Address()
+		if c.String("from") != "" && !strings.EqualFold(c.String("from"), from.Hex()) {
+			return xerrors.Errorf("the signing key belongs to %s, not %s", from.Hex(), c.String("from"))
+		}
 
-		var transactions []*jsonrpc.StEthTransaction
-		for _, pv := range pending {
-			for _, v := range pv {
-				if filter != "" && filter != v.From {
-					continue
-				}
-				transactions = append(transactions, v)
-			}
+		transactions, err := pendingTransactions(from.Hex())
+		if err != nil {
+			return err
 		}
 
 		if transactions == nil {
-			return nil
+			return printReplaceResults(nil, true)
 		}
 
-		netVer, err := client.EthRpcNetVersion()
+		ctx := context.Background()
+		sender, err := newSender(ctx, defaultEndPoint, signer, payments.FeeOptions{})
 		if err != nil {
-			log.Panicf("error net ver: %s", err.Error())
+			return err
 		}
 
-		log.Printf("netVer: %d\n", netVer)
+		log.Printf("chainID: %s\n", sender.ChainID)
 
-		fromKey := c.String("fromKey")
-		if strings.HasPrefix(fromKey, "0x") {
-			fromKey = fromKey[2:]
+		opts := payments.ReplaceOptions{NGasPrice: c.Uint64("nGasPrice"), Bump: c.Uint64("bump"), GasLimit: c.Uint64("gasLimit")}
+		var results []*ReplaceResult
+		for _, rpcTx := range transactions {
+			old, err := rpcTransaction(rpcTx)
+			if err != nil {
+				return xerrors.Errorf("tx %s: %w", rpcTx.Hash, err)
+			}
+
+			result, err := sender.Replace(ctx, old, opts)
+			results = append(results, newReplaceResult("replace", old.Nonce(), result, err))
+			if err == nil && !dryRun {
+				time.Sleep(1 * time.Second)
+			}
 		}
 
-		privateKey, err := crypto.HexToECDSA(fromKey)
+		return printReplaceResults(results, true)
+	},
+}
+
+var cancelCmd = &cli.Command{
+	Name:  "cancel",
+	Usage: "replace pending transactions with 0-value transfers to self",
+	Flags: append(append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Value: "",
+			Usage: "the wallet address whose transactions are cancelled (default: the address of the signing key)",
+		},
+		&cli.Int64Flag{
+			Name:  "nonce",
+			Value: -1,
+			Usage: "the nonce to cancel, pending or queued (default: all pending nonces of the wallet)",
+		},
+		&cli.Uint64Flag{
+			Name:  "bump",
+			Value: 10,
+			Usage: "the minimum gas price bump over the stuck transaction (percent)",
+		},
+		&cli.Uint64Flag{
+			Name:  "gasLimit",
+			Value: 21000, // in units
+			Usage: "the amount of gas limit (wei)",
+		},
+	}, feeFlags...), keyFlags...),
+	Action: func(c *cli.Context) error {
+		signer, err := loadSigner(c)
 		if err != nil {
-			log.Fatalf("err: [%T] %s", err, err.Error())
+			return err
 		}
 
-		for _, rpcTx := range transactions {
-			etchClient, err := ethclient.Dial(defaultEndPoint)
-			if err != nil {
-				return err
-			}
+		from := signer.Address()
+		if c.String("from") != "" && !strings.EqualFold(c.String("from"), from.Hex()) {
+			return xerrors.Errorf("the signing key belongs to %s, not %s", from.Hex(), c.String("from"))
+		}
 
-			gasPriceTimes := c.Uint64("nGasPrice")
-			gasPrice, err := etchClient.SuggestGasPrice(context.Background())
+		// 指定的 nonce 可能在 pending 或 queued 中，替换时要按原交易的价格提高手续费
+		byNonce := make(map[uint64]*jsonrpc.StEthTransaction)
+		var pending []uint64
+		for _, section := range []string{"pending", "queued"} {
+			transactions, err := poolTransactions(section, from.Hex())
 			if err != nil {
 				return err
 			}
+			for _, rpcTx := range transactions {
+				nonce, err := hexutil.DecodeUint64(rpcTx.Nonce)
+				if err != nil {
+					return xerrors.Errorf("error nonce: %s", rpcTx.Nonce)
+				}
+				byNonce[nonce] = rpcTx
+				if section == "pending" {
+					pending = append(pending, nonce)
+				}
+			}
+		}
 
-			gasPrice = gasPrice.Mul(gasPrice, big.NewInt(int64(gasPriceTimes)))
+		var nonces []uint64
+		if c.Int64("nonce") >= 0 {
+			nonces = append(nonces, uint64(c.Int64("nonce")))
+		} else {
+			nonces = pending
+			sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+		}
 
-			oldGasPrice, err := hexutil.DecodeBig(rpcTx.GasPrice)
-			if err != nil {
-				log.Fatalf("error gas price: %s", rpcTx.GasPrice)
-			}
+		if len(nonces) == 0 {
+			log.Println("no pending transactions to cancel")
+			return printReplaceResults(nil, false)
+		}
 
-			if gasPrice.Cmp(oldGasPrice) < 0 {
-				log.Println("Message does not need replace")
-				continue
-			}
+		feeOpts, err := feeOptionsFromContext(c)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		sender, err := newSender(ctx, defaultEndPoint, signer, feeOpts)
+		if err != nil {
+			return err
+		}
 
-			var inputBs []byte
-			if len(rpcTx.Input) > 0 {
-				inputBs, err = hexutil.Decode(rpcTx.Input)
-				if err != nil {
-					log.Fatalf("input decode err: %s", err.Error())
+		opts := payments.ReplaceOptions{NGasPrice: feeOpts.NGasPrice, Bump: c.Uint64("bump"), GasLimit: c.Uint64("gasLimit")}
+		var results []*ReplaceResult
+		for _, nonce := range nonces {
+			var old *types.Transaction
+			if rpcTx, ok := byNonce[nonce]; ok {
+				if old, err = rpcTransaction(rpcTx); err != nil {
+					return err
 				}
 			}
 
-			gasLimit, err := hexutil.DecodeUint64(rpcTx.Gas)
-			if err != nil {
-				log.Fatalf("error gas limit: %s", rpcTx.Gas)
-			}
+			result, err := sender.Cancel(ctx, nonce, old, opts)
+			results = append(results, newReplaceResult("cancel", nonce, result, err))
+		}
 
-			if c.Uint64("gasLimit") > gasLimit {
-				gasLimit = c.Uint64("gasLimit")
-			}
+		return printReplaceResults(results, false)
+	},
+}
 
-			nonce, err := hexutil.DecodeUint64(rpcTx.Nonce)
-			if err != nil {
-				log.Fatalf("error nonce: %s", rpcTx.Nonce)
-			}
-			value, err := hexutil.DecodeBig(rpcTx.Value)
-			if err != nil {
-				log.Fatalf("error value: %s", rpcTx.Value)
-			}
+const (
+	replaceSent     = "sent"
+	replaceRejected = "rejected"
+	replaceDryRun   = "dry-run"
+)
 
-			ethTx := types.NewTransaction(
-				nonce,
-				common.HexToAddress(rpcTx.To),
-				value,
-				gasLimit,
-				gasPrice,
-				inputBs,
-			)
-
-			// 签名
-			signedTx, err := types.SignTx(ethTx, types.NewEIP155Signer(big.NewInt(netVer)), privateKey)
-			if err != nil {
-				log.Fatalf("sign tx err: %s", err.Error())
-			}
-			ts, err := rlp.EncodeToBytes(signedTx)
-			if err != nil {
-				log.Fatalf("err encode tx: %s", err.Error())
-			}
+// ReplaceResult txpool replace 和 cancel 对一个 nonce 的处理结果。
+type ReplaceResult struct {
+	Nonce   uint64 `json:"nonce"`
+	OldFees string `json:"oldFees,omitempty"`
+	NewFees string `json:"newFees"`
+	Hash    string `json:"hash"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
 
-			rawTxHex := hexutil.Encode(ts)
-			txHash := strings.ToLower(signedTx.Hash().Hex())
-			log.Printf("tx: %s\n hex:\n%s\n", txHash, rawTxHex)
-			sendTxID, err := client.EthRpcSendRawTransaction(rawTxHex)
-			if err != nil {
-				log.Printf("send tx err: %s\n", err.Error())
-				continue
-			}
+func (r *ReplaceResult) String() string {
+	if r.OldFees == "" {
+		switch r.Status {
+		case replaceDryRun:
+			return fmt.Sprintf("nonce %d: %s: not sent (dry run) %s", r.Nonce, r.NewFees, r.Hash)
+		case replaceRejected:
+			return fmt.Sprintf("nonce %d: %s: rejected: %s", r.Nonce, r.NewFees, r.Error)
+		}
+		return fmt.Sprintf("nonce %d: %s: sent %s", r.Nonce, r.NewFees, r.Hash)
+	}
+
+	switch r.Status {
+	case replaceDryRun:
+		return fmt.Sprintf("nonce %d: %s -> %s: not sent (dry run) %s", r.Nonce, r.OldFees, r.NewFees, r.Hash)
+	case replaceRejected:
+		return fmt.Sprintf("nonce %d: %s -> %s: rejected: %s", r.Nonce, r.OldFees, r.NewFees, r.Error)
+	}
+	return fmt.Sprintf("nonce %d: %s -> %s: replaced by %s", r.Nonce, r.OldFees, r.NewFees, r.Hash)
+}
 
-			time.Sleep(1 *time.Second)
-			log.Printf("send result: %s\n", sendTxID)
+// printReplaceResults 按 nonce 排序输出结果，text 时 summary 为 false 不输出（cancel 已经逐条打印日志）。
+func printReplaceResults(results []*ReplaceResult, summary bool) error {
+	sort.Slice(results, func(i, j int) bool { return results[i].Nonce < results[j].Nonce })
+	if results == nil {
+		results = []*ReplaceResult{}
+	}
+	return printResult(results, func() {
+		if !summary {
+			return
 		}
+		for _, r := range results {
+			fmt.Println(r)
+		}
+	})
+}
 
-		return nil
-	},
+// pendingTransactions 返回交易池中指定地址的 pending 交易，地址不区分大小写。
+func pendingTransactions(from string) ([]*jsonrpc.StEthTransaction, error) {
+	return poolTransactions("pending", from)
+}
+
+// poolTransactions 返回交易池 section（pending 或 queued）中指定地址的交易，地址不区分大小写，为空时返回所有地址的交易。
+func poolTransactions(section, from string) ([]*jsonrpc.StEthTransaction, error) {
+	allTransactions, err := client.TxPoolContent(context.Background())
+	if err != nil {
+		return nil, xerrors.Errorf("txpool: %w", err)
+	}
+
+	var transactions []*jsonrpc.StEthTransaction
+	for address, pv := range allTransactions[section] {
+		if from != "" && !strings.EqualFold(address, from) {
+			continue
+		}
+		for _, v := range pv {
+			transactions = append(transactions, v)
+		}
+	}
+	return transactions, nil
+}
+
+// rpcTransaction 把交易池中的交易转换为带签名的 types.Transaction，用于确认发送者并计算替换交易。
+func rpcTransaction(rpcTx *jsonrpc.StEthTransaction) (*types.Transaction, error) {
+	d, err := decodePoolTx(rpcTx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if len(rpcTx.Input) > 0 {
+		if data, err = hexutil.Decode(rpcTx.Input); err != nil {
+			return nil, xerrors.Errorf("input: %w", err)
+		}
+	}
+
+	var to *common.Address
+	if rpcTx.To != "" {
+		address := common.HexToAddress(rpcTx.To)
+		to = &address
+	}
+
+	var sig [3]*big.Int
+	for i, field := range []struct{ name, value string }{{"v", rpcTx.V}, {"r", rpcTx.R}, {"s", rpcTx.S}} {
+		if sig[i], err = hexutil.DecodeBig(field.value); err != nil {
+			return nil, xerrors.Errorf("%s: %w", field.name, err)
+		}
+	}
+
+	if d.Type == types.LegacyTxType {
+		return types.NewTx(&types.LegacyTx{Nonce: d.Nonce, GasPrice: d.GasPrice, Gas: d.Gas, To: to, Value: d.Value, Data: data, V: sig[0], R: sig[1], S: sig[2]}), nil
+	}
+
+	chainID, err := hexutil.DecodeBig(rpcTx.ChainID)
+	if err != nil {
+		return nil, xerrors.Errorf("chainId: %w", err)
+	}
+	var accessList types.AccessList
+	if len(rpcTx.AccessList) > 0 {
+		if err := json.Unmarshal(rpcTx.AccessList, &accessList); err != nil {
+			return nil, xerrors.Errorf("accessList: %w", err)
+		}
+	}
+
+	switch d.Type {
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      d.Nonce,
+			GasPrice:   d.GasPrice,
+			Gas:        d.Gas,
+			To:         to,
+			Value:      d.Value,
+			Data:       data,
+			AccessList: accessList,
+			V:          sig[0],
+			R:          sig[1],
+			S:          sig[2],
+		}), nil
+	case types.DynamicFeeTxType:
+		if d.MaxFeePerGas == nil {
+			return nil, xerrors.New("maxFeePerGas missing in a dynamic fee transaction")
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      d.Nonce,
+			GasTipCap:  d.MaxPriorityFeePerGas,
+			GasFeeCap:  d.MaxFeePerGas,
+			Gas:        d.Gas,
+			To:         to,
+			Value:      d.Value,
+			Data:       data,
+			AccessList: accessList,
+			V:          sig[0],
+			R:          sig[1],
+			S:          sig[2],
+		}), nil
+	}
+	return nil, xerrors.Errorf("unsupported transaction type %d", d.Type)
+}
+
+// newReplaceResult 把 Sender.Replace 或 Cancel 的结果转换为 ReplaceResult 并输出日志，action 为日志中的操作名。
+// --dry-run 时模拟失败也记为 dry-run，Error 中为失败原因。
+func newReplaceResult(action string, nonce uint64, result *payments.Result, err error) *ReplaceResult {
+	r := &ReplaceResult{Nonce: nonce}
+	if result != nil {
+		r.NewFees, r.Hash = result.Fees.String(), result.Hash().Hex()
+		if result.OldFees != nil {
+			r.OldFees = result.OldFees.String()
+		}
+	}
+
+	switch {
+	case dryRun:
+		r.Status = replaceDryRun
+		if err != nil {
+			log.Printf("nonce %d: %s\n", nonce, err.Error())
+			r.Error = err.Error()
+		}
+	case err != nil:
+		log.Printf("nonce %d: %s rejected (%s): %s\n", nonce, action, r.NewFees, err.Error())
+		r.Status, r.Error = replaceRejected, err.Error()
+	default:
+		log.Printf("nonce %d: %s accepted (%s): %s\n", nonce, action, r.NewFees, r.Hash)
+		r.Status = replaceSent
+	}
+	return r
 }
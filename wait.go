@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+const receiptPollInterval = 3 * time.Second
+
+// droppedAfterPolls 交易连续多少次轮询都不在节点中时认为已被丢弃。
+const droppedAfterPolls = 10
+
+var (
+	ErrTxReverted = xerrors.New("transaction reverted")
+	ErrTxReplaced = xerrors.New("transaction replaced by another transaction with the same nonce")
+	ErrTxDropped  = xerrors.New("transaction dropped from the txpool")
+	ErrTxTimeout  = xerrors.New("timed out waiting for the transaction")
+)
+
+// waitFlags 发送交易后等待上链的参数。
+var waitFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "wait",
+		Value: false,
+		Usage: "wait until the transaction is mined and confirmed, exit non-zero if it reverts or is dropped",
+	},
+	&cli.Uint64Flag{
+		Name:  "confirmations",
+		Value: 1,
+		Usage: "the number of blocks (including the one with the transaction) to wait for",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Value: 30 * time.Minute,
+		Usage: "give up waiting after this long (0 waits forever)",
+	},
+}
+
+var TxCmd = &cli.Command{
+	Name:  "tx",
+	Usage: "build, sign, broadcast and wait for transactions",
+	Subcommands: []*cli.Command{
+		txBuildCmd,
+		txSignCmd,
+		txBroadcastCmd,
+		txWaitCmd,
+	},
+}
+
+var txWaitCmd = &cli.Command{
+	Name:      "wait",
+	Usage:     "wait for a transaction to be mined and confirmed",
+	ArgsUsage: "<hash>",
+	Flags:     waitFlags[1:],
+	Before:    connectNode,
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return xerrors.New("expected exactly one transaction hash")
+		}
+
+		client, err := ethclient.Dial(defaultEndPoint)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := waitContext(c)
+		defer cancel()
+
+		hash := common.HexToHash(c.Args().First())
+		tx, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return xerrors.Errorf("transaction %s: %w", hash.Hex(), err)
+		}
+
+		receipt, err := WaitForTx(ctx, client, tx, c.Uint64("confirmations"))
+		if err != nil {
+			return err
+		}
+
+		return printResult(newTxResult(tx, receipt), func() {
+			printReceipt(receipt)
+		})
+	},
+}
+
+// waitIfRequested 在指定 --wait 时等待交易确认，然后输出交易的结果。
+func waitIfRequested(c *cli.Context, tx *types.Transaction) error {
+	if !c.Bool("wait") || dryRun {
+		return printResult(newTxResult(tx, nil), nil)
+	}
+
+	client, err := ethclient.Dial(defaultEndPoint)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := waitContext(c)
+	defer cancel()
+
+	receipt, err := WaitForTx(ctx, client, tx, c.Uint64("confirmations"))
+	if err != nil {
+		return err
+	}
+
+	return printResult(newTxResult(tx, receipt), func() {
+		printReceipt(receipt)
+	})
+}
+
+func waitContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	if timeout := c.Duration("timeout"); timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// WaitForTx 轮询交易回执直到交易获得 confirmations 个确认。
+// 交易失败返回 ErrTxReverted，同一 nonce 被其他交易占用返回 ErrTxReplaced，交易从节点消失返回 ErrTxDropped。
+// 节点的临时错误（超时、断线、429 等）只记录日志并继续轮询，直到 ctx 结束返回 ErrTxTimeout。
+func WaitForTx(ctx context.Context, client *ethclient.Client, tx *types.Transaction, confirmations uint64) (*types.Receipt, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmations == 0 {
+		confirmations = 1
+	}
+
+	misses := 0
+	for {
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		switch {
+		case err == nil:
+			if receipt.Status == types.ReceiptStatusFailed {
+				return receipt, xerrors.Errorf("%s in block %s: %w", tx.Hash().Hex(), receipt.BlockNumber, ErrTxReverted)
+			}
+
+			head, err := client.BlockNumber(ctx)
+			if err != nil {
+				logPollError(ctx, tx, err)
+				break
+			}
+			if head+1 >= receipt.BlockNumber.Uint64()+confirmations {
+				return receipt, nil
+			}
+			log.Printf("tx %s mined in block %s, %d/%d confirmations", tx.Hash().Hex(), receipt.BlockNumber, head+1-receipt.BlockNumber.Uint64(), confirmations)
+			misses = 0
+
+		case xerrors.Is(err, ethereum.NotFound):
+			nonce, err := client.NonceAt(ctx, from, nil)
+			if err != nil {
+				logPollError(ctx, tx, err)
+				break
+			}
+			if nonce > tx.Nonce() {
+				// 回执可能恰好在两次查询之间上链，再确认一次，只有确定没有回执才是被替换
+				_, err := client.TransactionReceipt(ctx, tx.Hash())
+				switch {
+				case err == nil:
+					continue
+				case xerrors.Is(err, ethereum.NotFound):
+					return nil, xerrors.Errorf("%s (nonce %d): %w", tx.Hash().Hex(), tx.Nonce(), ErrTxReplaced)
+				}
+				logPollError(ctx, tx, err)
+				break
+			}
+
+			_, _, err = client.TransactionByHash(ctx, tx.Hash())
+			switch {
+			case err == nil:
+				misses = 0
+			case xerrors.Is(err, ethereum.NotFound):
+				misses++
+				if misses >= droppedAfterPolls {
+					return nil, xerrors.Errorf("%s (nonce %d): %w", tx.Hash().Hex(), tx.Nonce(), ErrTxDropped)
+				}
+			default:
+				logPollError(ctx, tx, err)
+			}
+
+		default:
+			logPollError(ctx, tx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("%s: %w", tx.Hash().Hex(), ErrTxTimeout)
+		case <-time.After(receiptPollInterval):
+		}
+	}
+}
+
+// logPollError 记录轮询时节点返回的错误，ctx 结束导致的错误不记录
+func logPollError(ctx context.Context, tx *types.Transaction, err error) {
+	if ctx.Err() == nil {
+		log.Printf("tx %s: %s, retrying", tx.Hash().Hex(), err.Error())
+	}
+}
+
+func printReceipt(receipt *types.Receipt) {
+	fmt.Printf("tx %s mined in block %s, status %d, gas used %d\n",
+		receipt.TxHash.Hex(), receipt.BlockNumber, receipt.Status, receipt.GasUsed)
+}